@@ -8,7 +8,12 @@ const Sw8Span = "sw8-span"
 const Sw8TraceBefore = "sw8-trace-before"
 const Sw8TraceAfter = "sw8-trace-after"
 
+const MetricsBefore = "metrics-before"
+const MetricsAfter = "metrics-after"
+
 const ComponentIDGINHttpServer = 5006
 const ComponentIDGOHttpClient = 5005
 const ComponentIDGoRedis = 5013
 const ComponentIDGoGorm = 5014
+const ComponentIDKafkaProducer = 40
+const ComponentIDKafkaConsumer = 41
@@ -1,5 +1,22 @@
 package contract
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// http调用错误分类，配合 errors.Is 使用
+var (
+	ErrHttpTimeout       = errors.New("http request timeout")
+	ErrHttpDNS           = errors.New("http dns lookup failed")
+	ErrHttpConnRefused   = errors.New("http connection refused")
+	ErrHttpConnection    = errors.New("http connection failed")
+	ErrHttpClientStatus  = errors.New("http response status 4xx")
+	ErrHttpServerStatus  = errors.New("http response status 5xx")
+	ErrHttpBusinessError = errors.New("http response business error")
+)
+
 type HttpResponseError struct {
 	Code int
 	Msg string
@@ -13,4 +30,80 @@ func (e *HttpResponseError) Error() string {
 
 func (e *HttpResponseError) Unwrap() error {
 	return e.Err
-}
\ No newline at end of file
+}
+
+func (e *HttpResponseError) Is(target error) bool {
+	switch target {
+	case ErrHttpClientStatus:
+		return e.Code >= 400 && e.Code < 500
+	case ErrHttpServerStatus:
+		return e.Code >= 500
+	}
+	return false
+}
+
+// HttpTransportError 请求未拿到响应，Kind 为错误分类
+type HttpTransportError struct {
+	Kind error
+	Err  error
+}
+
+func (e *HttpTransportError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HttpTransportError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HttpTransportError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// BusinessError 服务端返回的业务错误，例如 {"code":1001,"msg":"..."}
+type BusinessError struct {
+	HttpStatus int
+	Code       int
+	Msg        string
+	Body       []byte
+}
+
+func (e *BusinessError) Error() string {
+	return fmt.Sprintf("business error, code %d: %s", e.Code, e.Msg)
+}
+
+func (e *BusinessError) Is(target error) bool {
+	return target == ErrHttpBusinessError
+}
+
+// CircuitOpenError 目标host已熔断，请求未发出
+type CircuitOpenError struct {
+	Host       string
+	RetryAfter time.Duration // 距离进入半开状态的剩余时间
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker is open for host %s, retry after %s", e.Host, e.RetryAfter)
+}
+
+// RateLimitedError 超过出站限流或并发上限，请求未发出
+type RateLimitedError struct {
+	Key        string
+	RetryAfter time.Duration // 预计可获取令牌的等待时长，并发超限时为0
+}
+
+func (e *RateLimitedError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("http rate limit exceeded for %s, retry after %s", e.Key, e.RetryAfter)
+	}
+	return fmt.Sprintf("http concurrency limit exceeded for %s", e.Key)
+}
+
+// ResponseTooLargeError 响应体超过允许的最大字节数
+type ResponseTooLargeError struct {
+	Limit int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("http response body exceeds limit of %d bytes", e.Limit)
+}
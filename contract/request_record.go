@@ -20,4 +20,10 @@ type HttpRequestRecord struct {
 	Params         string `json:"params"`          //请求参数
 	Response       string `json:"response"`        //响应内容
 	Header         string `json:"header"`          //请求头
+	Attempt        int    `json:"attempt"`         //第几次尝试 重试时记录
+	DnsCost        int    `json:"dns_cost"`        //DNS解析耗时 毫秒
+	ConnectCost    int    `json:"connect_cost"`    //建立连接耗时 毫秒
+	TlsCost        int    `json:"tls_cost"`        //TLS握手耗时 毫秒
+	FirstByteCost  int    `json:"first_byte_cost"` //获取连接到响应首字节耗时 毫秒
+	ConnReused     bool   `json:"conn_reused"`     //是否复用连接
 }
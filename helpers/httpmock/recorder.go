@@ -0,0 +1,225 @@
+package httpmock
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+)
+
+// RecordMode 录制回放模式
+type RecordMode int
+
+const (
+	ModeReplay         RecordMode = iota // 只从golden文件回放，找不到时返回错误
+	ModeRecord                           // 请求真实服务并覆盖录制
+	ModeReplayOrRecord                   // 能回放时回放，否则请求真实服务并追加录制
+)
+
+// 录制时不写入golden文件的请求头
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Signature"}
+
+// Interaction golden文件中的一次请求及响应
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// 非UTF-8的请求体、响应体(如 protobuf、gzip)以base64保存，BodyEncoding 为 base64
+const bodyEncodingBase64 = "base64"
+
+type RecordedRequest struct {
+	Method       string      `json:"method"`
+	Url          string      `json:"url"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// encodeBody UTF-8 文本原样保存便于阅读，其它内容使用base64
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), bodyEncodingBase64
+}
+
+func decodeBody(body, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(body), nil
+	case bodyEncodingBase64:
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return nil, fmt.Errorf("httpmock: unsupported body encoding %s", encoding)
+}
+
+// Recorder 将真实请求录制到golden文件，之后离线回放，通过 HttpClientConfig.Transport 注入
+//
+//	recorder, _ := httpmock.NewRecorder("testdata/user_api.json", httpmock.ModeReplay, nil)
+//	defer recorder.Close()
+type Recorder struct {
+	path      string
+	mode      RecordMode
+	transport http.RoundTripper
+
+	lock         sync.Mutex
+	interactions []*Interaction
+	replayed     map[*Interaction]bool
+	changed      bool
+}
+
+// NewRecorder transport 为录制时使用的真实 Transport，默认 http.DefaultTransport
+func NewRecorder(path string, mode RecordMode, transport http.RoundTripper) (*Recorder, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	r := &Recorder{
+		path:      path,
+		mode:      mode,
+		transport: transport,
+		replayed:  make(map[*Interaction]bool),
+	}
+	if mode == ModeRecord {
+		return r, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && mode == ModeReplayOrRecord {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("httpmock: read golden file: %w", err)
+	}
+	if err = json.Unmarshal(content, &r.interactions); err != nil {
+		return nil, fmt.Errorf("httpmock: parse golden file %s: %w", path, err)
+	}
+	return r, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if r.mode != ModeRecord {
+		if interaction := r.replay(req, body); interaction != nil {
+			respBody, err := decodeBody(interaction.Response.Body, interaction.Response.BodyEncoding)
+			if err != nil {
+				return nil, err
+			}
+			return newResponse(req, interaction.Response.StatusCode, interaction.Response.Header, respBody), nil
+		}
+		if r.mode == ModeReplay {
+			return nil, fmt.Errorf("httpmock: no recorded interaction for %s %s", req.Method, req.URL.String())
+		}
+	}
+	return r.record(req, body)
+}
+
+// replay 按顺序取第一个未回放过的匹配记录，全部回放过时复用最后一个匹配的记录
+func (r *Recorder) replay(req *http.Request, body []byte) *Interaction {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var last *Interaction
+	for _, interaction := range r.interactions {
+		recorded := interaction.Request
+		if recorded.Method != req.Method || recorded.Url != req.URL.String() {
+			continue
+		}
+		if recordedBody, err := decodeBody(recorded.Body, recorded.BodyEncoding); err != nil || !bytes.Equal(recordedBody, body) {
+			continue
+		}
+		if !r.replayed[interaction] {
+			r.replayed[interaction] = true
+			return interaction
+		}
+		last = interaction
+	}
+	return last
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := &Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			Url:    req.URL.String(),
+			Header: redactHeader(req.Header),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     redactHeader(resp.Header),
+		},
+	}
+	interaction.Request.Body, interaction.Request.BodyEncoding = encodeBody(body)
+	interaction.Response.Body, interaction.Response.BodyEncoding = encodeBody(respBody)
+	r.lock.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.replayed[interaction] = true
+	r.changed = true
+	r.lock.Unlock()
+
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+func redactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range sensitiveHeaders {
+		redacted.Del(name)
+	}
+	return redacted
+}
+
+// Close 有新录制的记录时写入golden文件
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.changed {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	if err = os.WriteFile(r.path, content, 0644); err != nil {
+		return fmt.Errorf("httpmock: write golden file: %w", err)
+	}
+	r.changed = false
+	return nil
+}
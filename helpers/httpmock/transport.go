@@ -0,0 +1,291 @@
+package httpmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TestingT testing.T 的子集，避免引入 testing 包
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Transport 按预设的期望返回响应的 http.RoundTripper，通过 HttpClientConfig.Transport 注入
+//
+//	mock := httpmock.New()
+//	mock.Expect(http.MethodGet, "https://api.example.com/users/*").ReplyJSON(200, user)
+//	client := library.NewHttpClient(&library.HttpClientConfig{Transport: mock})
+//	defer mock.AssertExpectations(t)
+type Transport struct {
+	lock         sync.Mutex
+	expectations []*Expectation
+	unmatched    []string
+}
+
+func New() *Transport {
+	return &Transport{}
+}
+
+// Expect 注册一个期望，pattern 为完整URL，* 匹配任意字符，不含 ? 时忽略查询参数
+func (t *Transport) Expect(method, pattern string) *Expectation {
+	e := &Expectation{
+		method:  strings.ToUpper(method),
+		pattern: pattern,
+		url:     compileUrlPattern(pattern),
+		header:  make(http.Header),
+		times:   1,
+		status:  http.StatusOK,
+		reply:   make(http.Header),
+	}
+	t.lock.Lock()
+	t.expectations = append(t.expectations, e)
+	t.lock.Unlock()
+	return e
+}
+
+func compileUrlPattern(pattern string) *regexp.Regexp {
+	quoted := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, `.*`)
+	return regexp.MustCompile("^" + quoted + "$")
+}
+
+// RoundTrip 按注册顺序匹配第一个未用完的期望，没有匹配时返回错误
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+	}
+
+	t.lock.Lock()
+	var matched *Expectation
+	for _, e := range t.expectations {
+		if e.exhausted() || !e.match(req, body) {
+			continue
+		}
+		e.calls++
+		matched = e
+		break
+	}
+	if matched == nil {
+		t.unmatched = append(t.unmatched, req.Method+" "+req.URL.String())
+	}
+	t.lock.Unlock()
+
+	if matched == nil {
+		return nil, fmt.Errorf("httpmock: no expectation matches %s %s", req.Method, req.URL.String())
+	}
+	return matched.respond(req)
+}
+
+// Unmet 未达到调用次数的期望及未匹配的请求
+func (t *Transport) Unmet() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var unmet []string
+	for _, e := range t.expectations {
+		if e.times > 0 && e.calls < e.times {
+			unmet = append(unmet, fmt.Sprintf("%s %s called %d times, expected %d", e.method, e.pattern, e.calls, e.times))
+		}
+	}
+	for _, request := range t.unmatched {
+		unmet = append(unmet, "unexpected request "+request)
+	}
+	return unmet
+}
+
+// AssertExpectations 存在未满足的期望或未匹配的请求时测试失败
+func (t *Transport) AssertExpectations(tb TestingT) {
+	tb.Helper()
+	for _, msg := range t.Unmet() {
+		tb.Errorf("httpmock: %s", msg)
+	}
+}
+
+// Reset 清空所有期望及调用记录
+func (t *Transport) Reset() {
+	t.lock.Lock()
+	t.expectations = nil
+	t.unmatched = nil
+	t.lock.Unlock()
+}
+
+// Expectation 一个请求期望及其响应
+type Expectation struct {
+	method  string
+	pattern string
+	url     *regexp.Regexp
+	header  http.Header
+	body    func(body []byte) bool
+	times   int // <=0 不限次数
+	calls   int
+
+	status int
+	reply  http.Header
+	data   []byte
+	err    error
+	delay  time.Duration
+}
+
+// WithHeader 请求需包含该请求头
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	e.header.Add(key, value)
+	return e
+}
+
+// WithBody 自定义请求体匹配
+func (e *Expectation) WithBody(matcher func(body []byte) bool) *Expectation {
+	e.body = matcher
+	return e
+}
+
+// WithJSONBody 请求体与 v 序列化后的json语义相等
+func (e *Expectation) WithJSONBody(v interface{}) *Expectation {
+	expected, err := normalizeJSON(v)
+	if err != nil {
+		panic(fmt.Errorf("httpmock: marshal expected body: %w", err))
+	}
+	e.body = func(body []byte) bool {
+		var actual interface{}
+		if json.Unmarshal(body, &actual) != nil {
+			return false
+		}
+		return reflect.DeepEqual(expected, actual)
+	}
+	return e
+}
+
+func normalizeJSON(v interface{}) (interface{}, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	err = json.Unmarshal(content, &normalized)
+	return normalized, err
+}
+
+// Times 期望被调用的次数，默认1次
+func (e *Expectation) Times(times int) *Expectation {
+	e.times = times
+	return e
+}
+
+// AnyTimes 不限调用次数，也不要求必须被调用
+func (e *Expectation) AnyTimes() *Expectation {
+	e.times = 0
+	return e
+}
+
+// Reply 返回的状态码和响应体
+func (e *Expectation) Reply(status int, body []byte) *Expectation {
+	e.status = status
+	e.data = body
+	return e
+}
+
+// ReplyJSON 返回json响应体
+func (e *Expectation) ReplyJSON(status int, v interface{}) *Expectation {
+	content, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Errorf("httpmock: marshal reply body: %w", err))
+	}
+	e.reply.Set("Content-Type", "application/json")
+	return e.Reply(status, content)
+}
+
+// ReplyHeader 响应头
+func (e *Expectation) ReplyHeader(key, value string) *Expectation {
+	e.reply.Add(key, value)
+	return e
+}
+
+// ReplyError 返回传输错误，模拟超时、拒绝连接等
+func (e *Expectation) ReplyError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Delay 返回响应前等待，期间请求 context 取消时返回 context 错误
+func (e *Expectation) Delay(delay time.Duration) *Expectation {
+	e.delay = delay
+	return e
+}
+
+func (e *Expectation) exhausted() bool {
+	return e.times > 0 && e.calls >= e.times
+}
+
+func (e *Expectation) match(req *http.Request, body []byte) bool {
+	if e.method != "" && e.method != req.Method {
+		return false
+	}
+	target := req.URL.String()
+	if !strings.Contains(e.pattern, "?") {
+		u := *req.URL
+		u.RawQuery = ""
+		target = u.String()
+	}
+	if !e.url.MatchString(target) {
+		return false
+	}
+	for key, values := range e.header {
+		for _, value := range values {
+			if !containsValue(req.Header.Values(key), value) {
+				return false
+			}
+		}
+	}
+	return e.body == nil || e.body(body)
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Expectation) respond(req *http.Request) (*http.Response, error) {
+	if e.delay > 0 {
+		timer := time.NewTimer(e.delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return newResponse(req, e.status, e.reply, e.data), nil
+}
+
+func newResponse(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
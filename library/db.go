@@ -42,6 +42,13 @@ func NewDB(conf *MysqlConfig) (db *DB, err error) {
 	odb.SetMaxOpenConns(conf.MaxOpenConn)
 	odb.SetMaxIdleConns(conf.MaxIdleConn)
 
+	if conf.Metrics != nil {
+		if err = conf.Metrics.RegisterDBStats(conf.ConnectionName, odb); err != nil {
+			err = fmt.Errorf("database connection:[%s] register metrics: %w", conf.ConnectionName, err)
+			return
+		}
+	}
+
 	db = &DB{
 		odb,
 	}
@@ -4,20 +4,24 @@ import (
 	"context"
 	"github.com/ctl5563096/base/contract"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
 )
 
 type Dialer struct {
-	resolver DnsResolverInterface
-	dialer   net.Dialer
-	logger   *zap.Logger
+	resolver  DnsResolverInterface
+	dialer    net.Dialer
+	logger    *zap.Logger
+	rotateIps bool
+	counter   uint64
 }
 
 func NewDialer(conf *DialConfig) *Dialer {
 	return &Dialer{
-		logger: conf.Logger,
+		logger:    conf.Logger,
+		rotateIps: conf.RotateIps,
 		resolver: &DnsResolver{
 			Resolver:  net.Resolver{},
 			cacheTime: conf.DnsCacheTime,
@@ -39,6 +43,10 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.
 	}
 
 	ips, err := d.resolver.LookupHost(ctx, host)
+	if d.rotateIps && len(ips) > 1 {
+		offset := int(atomic.AddUint64(&d.counter, 1) % uint64(len(ips)))
+		ips = append(append(make([]string, 0, len(ips)), ips[offset:]...), ips[:offset]...)
+	}
 	for _, ip := range ips {
 		conn, err := d.dialer.DialContext(ctx, network, ip+":"+port)
 		if err == nil {
@@ -80,9 +80,49 @@ func NewGormDB(conf *GormConfig) (*GormDB, error) {
 		err = fmt.Errorf("gorm register skywalking failed: [%s] DB err: %w", conf.ConnectionName, err2)
 		return nil, err
 	}
+	if err = eGorm.WithMetricsHook(conf); err != nil {
+		err = fmt.Errorf("gorm register metrics failed: [%s] DB err: %w", conf.ConnectionName, err)
+		return nil, err
+	}
 	return eGorm, nil
 }
 
+// WithMetricsHook 记录sql执行次数、耗时及连接池指标
+func (gormDB *GormDB) WithMetricsHook(conf *GormConfig) error {
+	if conf.Metrics == nil {
+		return nil
+	}
+
+	var err error
+	errHandle := func(execute func(name string, fn func(*gorm.DB)) error, name string, fn func(*gorm.DB)) {
+		if err == nil {
+			err = execute(name, fn)
+		}
+	}
+	hook := MetricsGormHook{Name: conf.ConnectionName, Metrics: conf.Metrics}
+	errHandle(gormDB.Callback().Create().Before("gorm:before_create").Register, contract.MetricsBefore, hook.BeforeCallback)
+	errHandle(gormDB.Callback().Create().After("gorm:after_create").Register, contract.MetricsAfter, hook.AfterCallback("create"))
+	errHandle(gormDB.Callback().Delete().Before("gorm:before_delete").Register, contract.MetricsBefore, hook.BeforeCallback)
+	errHandle(gormDB.Callback().Delete().After("gorm:after_delete").Register, contract.MetricsAfter, hook.AfterCallback("delete"))
+	errHandle(gormDB.Callback().Update().Before("gorm:before_update").Register, contract.MetricsBefore, hook.BeforeCallback)
+	errHandle(gormDB.Callback().Update().After("gorm:after_update").Register, contract.MetricsAfter, hook.AfterCallback("update"))
+	errHandle(gormDB.Callback().Query().Before("gorm:query").Register, contract.MetricsBefore, hook.BeforeCallback)
+	errHandle(gormDB.Callback().Query().After("gorm:after_query").Register, contract.MetricsAfter, hook.AfterCallback("query"))
+	errHandle(gormDB.Callback().Raw().Before("gorm:raw").Register, contract.MetricsBefore, hook.BeforeCallback)
+	errHandle(gormDB.Callback().Raw().After("gorm:raw").Register, contract.MetricsAfter, hook.AfterCallback("raw"))
+	errHandle(gormDB.Callback().Row().Before("gorm:row").Register, contract.MetricsBefore, hook.BeforeCallback)
+	errHandle(gormDB.Callback().Row().After("gorm:row").Register, contract.MetricsAfter, hook.AfterCallback("row"))
+	if err != nil {
+		return err
+	}
+
+	rawDB, err := gormDB.DB.DB()
+	if err != nil {
+		return err
+	}
+	return conf.Metrics.RegisterDBStats(conf.ConnectionName, rawDB)
+}
+
 func (gormDB *GormDB) WithSkyWalkingHook(conf *GormConfig) error {
 	var err error
 	errHandle := func(execute func(name string, fn func(*gorm.DB)) error, name string, fn func(*gorm.DB)) {
@@ -1,13 +1,12 @@
 package library
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
-	"github.com/SkyAPM/go2sky"
 	"github.com/ctl5563096/base/contract"
 	"gorm.io/gorm"
-	agentv3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
 )
 
 // skyWalking接入hook
@@ -16,12 +15,12 @@ type SkyWalkingGormHook struct {
 }
 
 func (s SkyWalkingGormHook) BeforeCallback(db *gorm.DB) {
-	tracker := go2sky.GetGlobalTracer()
+	tracker := GetGlobalTracer()
 	if tracker == nil {
 		return
 	}
 
-	span, errT := tracker.CreateExitSpan(db.Statement.Context, "gorm", s.Peer, func(key, value string) error {
+	span, _, errT := tracker.StartExitSpan(db.Statement.Context, "gorm", s.Peer, SpanLayerDatabase, func(key, value string) error {
 		return nil
 	})
 	if errT != nil {
@@ -29,8 +28,7 @@ func (s SkyWalkingGormHook) BeforeCallback(db *gorm.DB) {
 	}
 	span.SetComponent(contract.ComponentIDGoGorm)
 	span.SetOperationName(fmt.Sprintf("%s->%v", getFuncName(4), db.Statement.Name()))
-	span.SetSpanLayer(agentv3.SpanLayer_Database)
-	span.Tag(go2sky.TagDBType, "gorm")
+	span.Tag(TagDBType, "gorm")
 	db.Set(contract.Sw8Span, span)
 	return
 }
@@ -40,12 +38,40 @@ func (s SkyWalkingGormHook) AfterCallback(db *gorm.DB) {
 	if ok == false {
 		return
 	}
-	if span, ok := val.(go2sky.Span); ok {
-		span.Tag(go2sky.TagDBStatement, fmt.Sprintf("%s", db.Statement.SQL.String()))
+	if span, ok := val.(SpanInterface); ok {
+		span.Tag(TagDBStatement, fmt.Sprintf("%s", db.Statement.SQL.String()))
 		if db.Error != nil {
-			span.Error(time.Now(), db.Error.Error())
+			span.Error(db.Error)
 		}
 		span.End()
 	}
 	return
 }
+
+const gormMetricsBeginKey = "metrics:begin"
+
+// MetricsGormHook 按操作类型记录sql执行次数及耗时
+type MetricsGormHook struct {
+	Name    string // 连接名称
+	Metrics *Metrics
+}
+
+func (h MetricsGormHook) BeforeCallback(db *gorm.DB) {
+	db.Set(gormMetricsBeginKey, time.Now())
+}
+
+func (h MetricsGormHook) AfterCallback(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		val, ok := db.Get(gormMetricsBeginKey)
+		if !ok {
+			return
+		}
+		if beginTime, ok := val.(time.Time); ok {
+			err := db.Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = nil
+			}
+			h.Metrics.ObserveDB(h.Name, operation, err, time.Since(beginTime))
+		}
+	}
+}
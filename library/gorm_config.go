@@ -22,6 +22,7 @@ type GormConfig struct {
 	ReadOnlySlavesConfigs []GormSlaveConfig //只读实例配置
 	GormDetailConfig      *gorm.Config      // 配置详情
 	EnableSkyWalking      bool              // 是否开启链路追终
+	Metrics               *Metrics          // 不为nil时记录sql执行及连接池指标
 }
 
 type GormSlaveConfig struct {
@@ -0,0 +1,308 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// 健康状态
+const (
+	HealthUp       = "up"
+	HealthDegraded = "degraded" // 非关键依赖异常
+	HealthDown     = "down"     // 关键依赖异常
+)
+
+const (
+	defaultHealthTimeout  = 3 * time.Second
+	defaultHealthCacheTTL = 5 * time.Second
+)
+
+// HealthNoCache 用于 HealthCheckConfig.CacheSecond，不缓存检查结果
+const HealthNoCache = -1
+
+// HealthCheckerInterface 依赖的健康检查，正常时返回nil
+type HealthCheckerInterface interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// HealthCheckFunc 函数形式的健康检查
+type HealthCheckFunc func(ctx context.Context) error
+
+func (f HealthCheckFunc) HealthCheck(ctx context.Context) error {
+	return f(ctx)
+}
+
+// HealthCheckConfig 注册健康检查时的配置
+type HealthCheckConfig struct {
+	Name          string // 组件名称，如 mysql-main、redis、user-center
+	Critical      bool   // 是否关键依赖，异常时就绪检查失败，否则只标记为 degraded
+	TimeoutSecond int    // 单次检查超时时间，默认3s
+	CacheSecond   int    // 检查结果缓存时间，避免探针频繁请求依赖，默认5s，HealthNoCache 不缓存
+}
+
+// HealthComponentStatus 单个组件的检查结果
+type HealthComponentStatus struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+	CheckedAt string `json:"checked_at"` // 格式:2006-01-02 15:04:05.000
+	Cached    bool   `json:"cached"`
+}
+
+// HealthReport 汇总结果
+type HealthReport struct {
+	Status     string                  `json:"status"`
+	Components []HealthComponentStatus `json:"components,omitempty"`
+}
+
+type healthCheck struct {
+	conf     HealthCheckConfig
+	checker  HealthCheckerInterface
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	lock      sync.Mutex
+	last      HealthComponentStatus
+	expiresAt time.Time
+}
+
+// HealthRegistry 注册各依赖的健康检查，供 /health/ready 汇总
+type HealthRegistry struct {
+	lock   sync.RWMutex
+	checks map[string]*healthCheck
+}
+
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{checks: make(map[string]*healthCheck)}
+}
+
+// Register 注册健康检查，同名时覆盖
+func (r *HealthRegistry) Register(conf HealthCheckConfig, checker HealthCheckerInterface) {
+	check := &healthCheck{
+		conf:     conf,
+		checker:  checker,
+		timeout:  time.Duration(conf.TimeoutSecond) * time.Second,
+		cacheTTL: time.Duration(conf.CacheSecond) * time.Second,
+	}
+	if check.timeout <= 0 {
+		check.timeout = defaultHealthTimeout
+	}
+	if conf.CacheSecond == 0 {
+		check.cacheTTL = defaultHealthCacheTTL
+	}
+
+	r.lock.Lock()
+	r.checks[conf.Name] = check
+	r.lock.Unlock()
+}
+
+// Unregister 移除健康检查
+func (r *HealthRegistry) Unregister(name string) {
+	r.lock.Lock()
+	delete(r.checks, name)
+	r.lock.Unlock()
+}
+
+// Live 存活检查，只表示进程可以响应，不检查依赖
+func (r *HealthRegistry) Live() HealthReport {
+	return HealthReport{Status: HealthUp}
+}
+
+// Ready 并发执行所有检查，任一关键依赖异常时为 down，仅非关键依赖异常时为 degraded
+func (r *HealthRegistry) Ready(ctx context.Context) HealthReport {
+	r.lock.RLock()
+	checks := make([]*healthCheck, 0, len(r.checks))
+	for _, check := range r.checks {
+		checks = append(checks, check)
+	}
+	r.lock.RUnlock()
+
+	report := HealthReport{Status: HealthUp, Components: make([]HealthComponentStatus, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check *healthCheck) {
+			defer wg.Done()
+			report.Components[i] = check.run(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	sort.Slice(report.Components, func(i, j int) bool {
+		return report.Components[i].Name < report.Components[j].Name
+	})
+	for _, component := range report.Components {
+		if component.Status == HealthUp {
+			continue
+		}
+		if component.Critical {
+			report.Status = HealthDown
+		} else if report.Status == HealthUp {
+			report.Status = HealthDegraded
+		}
+	}
+	return report
+}
+
+// run 缓存未过期时直接返回，同一检查同时只执行一次
+func (c *healthCheck) run(ctx context.Context) HealthComponentStatus {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	if now.Before(c.expiresAt) {
+		status := c.last
+		status.Cached = true
+		return status
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	err := c.checker.HealthCheck(checkCtx)
+	status := HealthComponentStatus{
+		Name:      c.conf.Name,
+		Status:    HealthUp,
+		Critical:  c.conf.Critical,
+		LatencyMs: time.Since(now).Milliseconds(),
+		CheckedAt: now.Format("2006-01-02 15:04:05.000"),
+	}
+	if err != nil {
+		status.Status = HealthDown
+		status.Error = err.Error()
+	}
+	c.last = status
+	if c.cacheTTL > 0 {
+		c.expiresAt = now.Add(c.cacheTTL)
+	}
+	return status
+}
+
+// HttpTargetChecker 请求下游服务的健康检查地址，2xx 视为正常
+type HttpTargetChecker struct {
+	Client *HttpClient
+	Url    string
+}
+
+func NewHttpTargetChecker(client *HttpClient, url string) *HttpTargetChecker {
+	return &HttpTargetChecker{Client: client, Url: url}
+}
+
+func (c *HttpTargetChecker) HealthCheck(ctx context.Context) error {
+	_, err := c.Client.NewRequest(ctx).
+		URL(c.Url).
+		NoCache().
+		Do()
+	return err
+}
+
+// HealthCheck 有host处于熔断或半开状态时返回错误，通常注册为非关键依赖，就绪检查显示为 degraded
+func (c *HttpClient) HealthCheck(ctx context.Context) error {
+	hosts := c.DegradedHosts()
+	if len(hosts) == 0 {
+		return nil
+	}
+	sort.Strings(hosts)
+	return fmt.Errorf("http circuit breaker is not closed for %s", strings.Join(hosts, ","))
+}
+
+func (db *DB) HealthCheck(ctx context.Context) error {
+	return db.PingContext(ctx)
+}
+
+func (gormDB *GormDB) HealthCheck(ctx context.Context) error {
+	rawDB, err := gormDB.DB.DB()
+	if err != nil {
+		return err
+	}
+	return rawDB.PingContext(ctx)
+}
+
+func (cli *RedisClient) HealthCheck(ctx context.Context) error {
+	return cli.Ping(ctx).Err()
+}
+
+func (cli *MongoClient) HealthCheck(ctx context.Context) error {
+	return cli.Client.Ping(ctx, nil)
+}
+
+func (es *ElasticV7) HealthCheck(ctx context.Context) error {
+	res, err := es.ClusterHealth().Do(ctx)
+	if err != nil {
+		return err
+	}
+	if res.Status == "red" {
+		return fmt.Errorf("elastic cluster %s status is red", res.ClusterName)
+	}
+	return nil
+}
+
+func (es *ElasticV6) HealthCheck(ctx context.Context) error {
+	res, err := es.ClusterHealth().Do(ctx)
+	if err != nil {
+		return err
+	}
+	if res.Status == "red" {
+		return fmt.Errorf("elastic cluster %s status is red", res.ClusterName)
+	}
+	return nil
+}
+
+func (producer *KafkaSyncProducer) HealthCheck(ctx context.Context) error {
+	return kafkaClientHealthCheck(ctx, producer.client)
+}
+
+func (producer *KafkaAsyncProducer) HealthCheck(ctx context.Context) error {
+	return kafkaClientHealthCheck(ctx, producer.client)
+}
+
+func (c *KafkaGroupConsumer) HealthCheck(ctx context.Context) error {
+	return kafkaClientHealthCheck(ctx, c.client)
+}
+
+// kafkaClientHealthCheck Controller 可能在 sarama 的元数据重试期间阻塞，超过 ctx 截止时间时直接返回
+func kafkaClientHealthCheck(ctx context.Context, client sarama.Client) error {
+	if client == nil {
+		return fmt.Errorf("kafka client is not initialized")
+	}
+	if client.Closed() {
+		return fmt.Errorf("kafka client is closed")
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := client.Controller()
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		if err != nil {
+			return fmt.Errorf("kafka controller unavailable: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("kafka controller unavailable: %w", ctx.Err())
+	}
+}
+
+// HealthCheck 服务关闭过程中返回错误，使就绪检查先于连接排空失败，注册时使用 HealthCheckConfig 生成的配置
+func (s *HttpServer) HealthCheck(ctx context.Context) error {
+	if !s.Ready() {
+		return fmt.Errorf("http server %s is not ready", s.Addr)
+	}
+	return nil
+}
+
+// HealthCheckConfig 注册 HttpServer 健康检查的配置，关键依赖且不缓存，关闭时就绪检查立即失败
+//
+//	registry.Register(server.HealthCheckConfig("http-server"), server)
+func (s *HttpServer) HealthCheckConfig(name string) HealthCheckConfig {
+	return HealthCheckConfig{Name: name, Critical: true, CacheSecond: HealthNoCache}
+}
@@ -1,8 +1,8 @@
 package library
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,20 +10,37 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"sync"
 	"time"
 
-	"github.com/SkyAPM/go2sky"
 	"github.com/ctl5563096/base/helpers/network"
-	agentv3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
 )
 
 type HttpClient struct {
 	*http.Client
+	retryPolicy *httpRetryPolicy
+	breakers    *httpCircuitBreakers
+	balancer    *httpLoadBalancer
+	cache       *httpResponseCache
+	rateLimiter *httpRateLimiter
+	pool        *httpPoolStats
+
+	errorDecoder HttpErrorDecoderInterface
+	auth         HttpAuthProviderInterface
+	metrics      *Metrics
+
+	maxResponseBytes    int64
+	maxLogResponseBytes int
+
+	interceptorLock sync.RWMutex
+	interceptors    []HttpInterceptor // 为nil时使用 DefaultHttpInterceptors
+	chain           HttpRoundTripFunc
 }
 
 func NewHttpClient(config *HttpClientConfig) (httpClient *HttpClient) {
-	helpe
+	tlsConfig, proxy := mustHttpTransportOptions(config.Name, &config.TLSConf, &config.ProxyConf)
 	httpClient = &HttpClient{
 		Client: &http.Client{
 			Timeout: time.Duration(config.RequestTimeoutSecond) * time.Second,
@@ -32,18 +49,36 @@ func NewHttpClient(config *HttpClientConfig) (httpClient *HttpClient) {
 				MaxIdleConns:        config.MaxIdleConnections,
 				MaxIdleConnsPerHost: config.MaxIdleConnectionsPerHost,
 				IdleConnTimeout:     time.Duration(config.IdleConnTimeoutSecond) * time.Second,
-				Proxy:               http.ProxyFromEnvironment,
+				Proxy:               proxy,
+				TLSClientConfig:     tlsConfig,
 				DialContext: (&net.Dialer{
 					Timeout:   time.Duration(config.DialTimeoutSecond) * time.Second,
 					KeepAlive: time.Duration(config.DialKeepAliveSecond) * time.Second,
 				}).DialContext,
 			},
 		},
+		retryPolicy: newHttpRetryPolicy(&config.RetryConf),
+		breakers:    newHttpCircuitBreakers(&config.BreakerConf),
+		balancer:    newHttpLoadBalancer(&config.LoadBalanceConf),
+		cache:       newHttpResponseCache(&config.CacheConf),
+		rateLimiter: newHttpRateLimiter(&config.RateLimitConf),
+
+		errorDecoder: newHttpErrorDecoder(config.ErrorDecoder),
+		auth:         config.Auth,
+		metrics:      config.Metrics,
+
+		maxResponseBytes:    config.MaxResponseBytes,
+		maxLogResponseBytes: config.MaxLogResponseBytes,
+	}
+	if config.Transport != nil {
+		httpClient.Client.Transport = config.Transport
 	}
+	httpClient.applyHttpVersion(config.HttpVersion)
 	return
 }
 
 func NewHttpClientCache(config *HttpClientCacheConfig) (httpClient *HttpClient) {
+	tlsConfig, proxy := mustHttpTransportOptions(config.Name, &config.TLSConf, &config.ProxyConf)
 	httpClient = &HttpClient{
 		Client: &http.Client{
 			Timeout: time.Duration(config.RequestTimeoutSecond) * time.Second,
@@ -52,200 +87,86 @@ func NewHttpClientCache(config *HttpClientCacheConfig) (httpClient *HttpClient)
 				MaxIdleConns:        config.MaxIdleConnections,
 				MaxIdleConnsPerHost: config.MaxIdleConnectionsPerHost,
 				IdleConnTimeout:     time.Duration(config.IdleConnTimeoutSecond) * time.Second,
-				Proxy:               http.ProxyFromEnvironment,
+				Proxy:               proxy,
+				TLSClientConfig:     tlsConfig,
 				DialContext:         NewDialer(&config.DialConf).DialContext,
 			},
 		},
-	}
-	return
-}
+		retryPolicy: newHttpRetryPolicy(&config.RetryConf),
+		breakers:    newHttpCircuitBreakers(&config.BreakerConf),
+		balancer:    newHttpLoadBalancer(&config.LoadBalanceConf),
+		cache:       newHttpResponseCache(&config.CacheConf),
+		rateLimiter: newHttpRateLimiter(&config.RateLimitConf),
 
-func (c *HttpClient) Get(ctx context.Context, url string, header map[string]string, logger contract.XiaoeRequestLoggerInterface) (response []byte, err error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	var clientResp *http.Response
-	var paramsString string
-	var beginTime = time.Now()
-	defer recordLog(req, &clientResp, &paramsString, &response, &err, beginTime, logger)
-	if err != nil {
-		return nil, err
-	}
-
-	addXeHeader(ctx, req)
-	addCustomHeader(req, header)
-
-	clientResp, err = c.Do(req)
-
-	if err != nil {
-		err = fmt.Errorf("response is nil: %w", err)
-		return nil, err
-	}
+		errorDecoder: newHttpErrorDecoder(config.ErrorDecoder),
+		auth:         config.Auth,
+		metrics:      config.Metrics,
 
-	if clientResp == nil {
-		err = fmt.Errorf("response is nil: %w", err)
-		return nil, err
+		maxResponseBytes:    config.MaxResponseBytes,
+		maxLogResponseBytes: config.MaxLogResponseBytes,
 	}
-	defer clientResp.Body.Close()
-
-	//2开头的状态码都是OK
-	if clientResp.StatusCode < 200 || clientResp.StatusCode >= 300 {
-		resBody, _ := getBytesFromHttpResponse(clientResp)
-		err = &contract.HttpResponseError{
-			Code:         clientResp.StatusCode,
-			Msg:          fmt.Sprintf("response error, code %d", clientResp.StatusCode),
-			ResponseBody: resBody,
-		}
-		return nil, err
+	if config.Transport != nil {
+		httpClient.Client.Transport = config.Transport
 	}
-
-	response, err = getBytesFromHttpResponse(clientResp)
-
-	return response, err
+	httpClient.applyHttpVersion(config.HttpVersion)
+	return
 }
 
-func (c *HttpClient) GetV2(ctx context.Context, url string, query map[string]string, header map[string]string, logger contract.XiaoeRequestLoggerInterface) (response []byte, err error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	var clientResp *http.Response
-	var paramsString string
-	var beginTime = time.Now()
-	defer recordLog(req, &clientResp, &paramsString, &response, &err, beginTime, logger)
+// mustHttpTransportOptions 证书或代理配置错误时 panic
+func mustHttpTransportOptions(name string, tlsConf *HttpTLSConfig, proxyConf *HttpProxyConfig) (*tls.Config, func(*http.Request) (*url.URL, error)) {
+	tlsConfig, err := newHttpTLSConfig(tlsConf)
 	if err != nil {
-		return nil, err
+		panic(fmt.Errorf("http client:[%s] tls error:%w", name, err))
 	}
-
-	addXeHeader(ctx, req)
-	addCustomHeader(req, header)
-
-	// 拼接参数
-	q := req.URL.Query()
-	for key, val := range query {
-		q.Add(key, val)
-	}
-	req.URL.RawQuery = q.Encode()
-
-	clientResp, err = c.Do(req)
-
+	proxy, err := newHttpProxy(proxyConf)
 	if err != nil {
-		err = fmt.Errorf("response is nil: %w", err)
-		return nil, err
-	}
-
-	if clientResp == nil {
-		err = fmt.Errorf("response is nil: %w", err)
-		return nil, err
-	}
-	defer clientResp.Body.Close()
-
-	//2开头的状态码都是OK
-	if clientResp.StatusCode < 200 || clientResp.StatusCode >= 300 {
-		resBody, _ := getBytesFromHttpResponse(clientResp)
-		err = &contract.HttpResponseError{
-			Code:         clientResp.StatusCode,
-			Msg:          fmt.Sprintf("response error, code %d", clientResp.StatusCode),
-			ResponseBody: resBody,
-		}
-		return nil, err
+		panic(fmt.Errorf("http client:[%s] proxy error:%w", name, err))
 	}
+	return tlsConfig, proxy
+}
 
-	response, err = getBytesFromHttpResponse(clientResp)
+func (c *HttpClient) Get(ctx context.Context, url string, header map[string]string, logger contract.XiaoeRequestLoggerInterface) (response []byte, err error) {
+	return c.NewRequest(ctx).
+		URL(url).
+		Headers(header).
+		Logger(logger).
+		Do()
+}
 
-	return response, err
+func (c *HttpClient) GetV2(ctx context.Context, url string, query map[string]string, header map[string]string, logger contract.XiaoeRequestLoggerInterface) (response []byte, err error) {
+	return c.NewRequest(ctx).
+		URL(url).
+		QueryMap(query).
+		Headers(header).
+		Logger(logger).
+		Do()
 }
 
 func (c *HttpClient) Post(ctx context.Context, url string, params []byte, header map[string]string, logger contract.XiaoeRequestLoggerInterface) (response []byte, err error) {
-	var clientResp *http.Response
-	var paramsString string
-	var beginTime = time.Now()
-	var body io.Reader
+	req := c.NewRequest(ctx).
+		Method(http.MethodPost).
+		URL(url).
+		Headers(header).
+		Logger(logger)
 	if params != nil {
-		body = bytes.NewReader(params)
-		paramsString = string(params)
-	}
-	req, e := http.NewRequestWithContext(ctx, "POST", url, body)
-	defer recordLog(req, &clientResp, &paramsString, &response, &err, beginTime, logger)
-	if e != nil {
-		err = e
-		return nil, e
-	}
-
-	addXeHeader(ctx, req)
-	addCustomHeader(req, header)
-
-	clientResp, err = c.Do(req)
-
-	if err != nil {
-		err = fmt.Errorf("response is nil: %w", err)
-		return nil, err
-	}
-
-	if clientResp == nil {
-		err = fmt.Errorf("response is nil: %w", err)
-		return nil, err
-	}
-	defer clientResp.Body.Close()
-	//2开头的状态码都是OK
-	if clientResp.StatusCode < 200 || clientResp.StatusCode >= 300 {
-		resBody, _ := getBytesFromHttpResponse(clientResp)
-		err = &contract.HttpResponseError{
-			Code:         clientResp.StatusCode,
-			Msg:          fmt.Sprintf("response error, code %d", clientResp.StatusCode),
-			ResponseBody: resBody,
-		}
-		return nil, err
+		req.RawBody("", params)
 	}
-
-	response, err = getBytesFromHttpResponse(clientResp)
-
-	return response, err
+	return req.Do()
 }
-func (c *HttpClient) GetJsonWithHeader(ctx context.Context, url string, header map[string]string, response interface{}, logger contract.XiaoeRequestLoggerInterface) error {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	var responseBytes []byte
-	var clientResp *http.Response
-	var params string
-	var beginTime = time.Now()
-	defer recordLog(req, &clientResp, &params, &responseBytes, &err, beginTime, logger)
-	if err != nil {
-		return err
-	}
-
-	addJsonHeader(req)
-	addXeHeader(ctx, req)
-	addCustomHeader(req, header)
-
-	clientResp, err = c.Do(req)
-
-	if err != nil {
-		err = fmt.Errorf("response is nil: %w", err)
-		return err
-	}
-
-	if clientResp == nil {
-		err = fmt.Errorf("response is nil: %w", err)
-		return err
-	}
-	defer clientResp.Body.Close()
-
-	if clientResp.StatusCode != http.StatusOK {
-		err = &contract.HttpResponseError{
-			Code: clientResp.StatusCode,
-			Msg:  fmt.Sprintf("response error, code %d", clientResp.StatusCode),
-		}
-		return err
-	}
-
-	responseBytes, err = getBytesFromHttpResponse(clientResp)
-	if err != nil {
-		return err
-	}
 
+func (c *HttpClient) GetJsonWithHeader(ctx context.Context, url string, header map[string]string, response interface{}, logger contract.XiaoeRequestLoggerInterface) error {
 	if response == nil {
 		response = &(map[string]interface{}{})
 	}
 
-	if err = json.Unmarshal(responseBytes, response); err != nil {
-		return err
-	}
-
+	_, err := c.NewRequest(ctx).
+		URL(url).
+		Header("Content-Type", "application/json").
+		Header("Accept", "application/json").
+		Headers(header).
+		Decode(response).
+		Logger(logger).
+		Do()
 	return err
 }
 
@@ -254,68 +175,18 @@ func (c *HttpClient) GetJson(ctx context.Context, url string, response interface
 }
 
 func (c *HttpClient) PostJsonWithHeader(ctx context.Context, url string, params interface{}, header map[string]string, response interface{}, logger contract.XiaoeRequestLoggerInterface) error {
-	var responseBytes []byte
-	var clientResp *http.Response
-	var paramsString string
-	var beginTime = time.Now()
-	var body io.Reader
-	var err error
-	if params != nil {
-		paramsBytes, e := json.Marshal(params)
-		if e != nil {
-			return e
-		}
-
-		if paramsBytes != nil {
-			body = bytes.NewReader(paramsBytes)
-			paramsString = string(paramsBytes)
-		}
-
-	}
-	req, e := http.NewRequestWithContext(ctx, "POST", url, body)
-	defer recordLog(req, &clientResp, &paramsString, &responseBytes, &err, beginTime, logger)
-	if e != nil {
-		err = e
-		return err
-	}
-	addJsonHeader(req)
-	addXeHeader(ctx, req)
-	addCustomHeader(req, header)
-
-	clientResp, err = c.Do(req)
-
-	if err != nil {
-		err = fmt.Errorf("response is nil: %w", err)
-		return err
-	}
-
-	if clientResp == nil {
-		err = fmt.Errorf("response is nil: %w", err)
-		return err
-	}
-	defer clientResp.Body.Close()
-
-	if clientResp.StatusCode != http.StatusOK {
-		err = &contract.HttpResponseError{
-			Code: clientResp.StatusCode,
-			Msg:  fmt.Sprintf("response error, code %d", clientResp.StatusCode),
-		}
-		return err
-	}
-
-	responseBytes, err = getBytesFromHttpResponse(clientResp)
-	if err != nil {
-		return err
-	}
-
 	if response == nil {
 		response = &(map[string]interface{}{})
 	}
 
-	if err = json.Unmarshal(responseBytes, response); err != nil {
-		return err
-	}
-
+	_, err := c.NewRequest(ctx).
+		Method(http.MethodPost).
+		URL(url).
+		JSONBody(params).
+		Headers(header).
+		Decode(response).
+		Logger(logger).
+		Do()
 	return err
 }
 
@@ -323,47 +194,62 @@ func (c *HttpClient) PostJson(ctx context.Context, url string, params interface{
 	return c.PostJsonWithHeader(ctx, url, params, nil, response, logger)
 }
 
-// 重新封装Do逻辑、添加skyWalking代码
+// 重新封装Do逻辑、请求经过拦截器链后发出
 func (c *HttpClient) Do(req *http.Request) (resp *http.Response, err error) {
-	// 无tracer
-	tracer := go2sky.GetGlobalTracer()
-	if tracer == nil {
-		resp, err = c.Client.Do(req)
-		return
+	if getHttpCallState(req.Context()) == nil {
+		req = req.WithContext(withHttpCallState(req.Context(), &httpCallState{}))
 	}
+	return c.roundTripChain()(req)
+}
 
-	operateName := fmt.Sprintf("/%s%s", req.Method, req.URL.Path)
-	// 创建tracer span失败
-	span, err := tracer.CreateExitSpan(req.Context(), operateName, req.URL.Host, func(key, value string) error {
-		req.Header.Set(key, value)
-		return nil
-	})
-	if err != nil {
-		fmt.Printf("Get CreateExitSpan err: %v", err)
-		resp, err = c.Client.Do(req)
-		return
-	}
-	defer span.End()
-
-	// skywalking、执行Do参数
-	/*	for k, v := range t.extraTags {
-		span.Tag(go2sky.Tag(k), v)
-	}*/
-	span.SetComponent(contract.ComponentIDGOHttpClient)
-	span.Tag(go2sky.TagHTTPMethod, req.Method)
-	span.Tag(go2sky.TagURL, req.URL.String())
-	span.SetSpanLayer(agentv3.SpanLayer_Http)
-	resp, err = c.Client.Do(req)
-	if err != nil {
-		span.Error(time.Now(), err.Error())
-		return
-	}
+// tracingInterceptor 每次尝试创建一个 exit span
+func tracingInterceptor(next HttpRoundTripFunc) HttpRoundTripFunc {
+	return func(req *http.Request) (resp *http.Response, err error) {
+		// 无tracer
+		tracer := GetGlobalTracer()
+		if tracer == nil {
+			return next(req)
+		}
 
-	span.Tag(go2sky.TagStatusCode, strconv.Itoa(resp.StatusCode))
-	if resp.StatusCode >= http.StatusBadRequest {
-		span.Error(time.Now(), "Errors on handling client")
+		operateName := fmt.Sprintf("/%s%s", req.Method, req.URL.Path)
+		// 创建tracer span失败
+		span, ctx, err := tracer.StartExitSpan(req.Context(), operateName, req.URL.Host, SpanLayerHttp, func(key, value string) error {
+			req.Header.Set(key, value)
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Get CreateExitSpan err: %v", err)
+			return next(req)
+		}
+		defer span.End()
+		req = req.WithContext(ctx)
+
+		span.SetComponent(contract.ComponentIDGOHttpClient)
+		span.Tag(TagHTTPMethod, req.Method)
+		span.Tag(TagURL, req.URL.String())
+		if state := getHttpCallState(req.Context()); state != nil {
+			span.Tag("http.attempt", strconv.Itoa(state.attempt))
+		}
+		resp, err = next(req)
+		if err != nil {
+			span.Error(err)
+			return
+		}
+
+		span.Tag(TagStatusCode, strconv.Itoa(resp.StatusCode))
+		if state := getHttpCallState(req.Context()); state != nil && state.timings != nil {
+			dns, connect, tlsCost, firstByte, reused := state.timings.durations()
+			span.Tag("http.dns_ms", strconv.Itoa(dns))
+			span.Tag("http.connect_ms", strconv.Itoa(connect))
+			span.Tag("http.tls_ms", strconv.Itoa(tlsCost))
+			span.Tag("http.first_byte_ms", strconv.Itoa(firstByte))
+			span.Tag("http.conn_reused", strconv.FormatBool(reused))
+		}
+		if resp.StatusCode >= http.StatusBadRequest {
+			span.Error(fmt.Errorf("Errors on handling client"))
+		}
+		return
 	}
-	return
 }
 
 func (c *HttpClient) Close() error {
@@ -371,35 +257,34 @@ func (c *HttpClient) Close() error {
 	return nil
 }
 
-func addCustomHeader(req *http.Request, header map[string]string) {
-	for k, v := range header {
-		req.Header.Add(k, v)
-	}
-}
-
-func getBytesFromHttpResponse(response *http.Response) (b []byte, err error) {
+// getBytesFromHttpResponse 读取完整响应体，limit>0 时超出返回 *contract.ResponseTooLargeError
+func getBytesFromHttpResponse(response *http.Response, limit int64) (b []byte, err error) {
 	if response == nil {
 		return nil, errors.New("http response is nil")
 	}
-	if response.ContentLength > 0 {
-		b = make([]byte, response.ContentLength)
-		readBytes := 0
-		for {
-			n, e := response.Body.Read(b[readBytes:])
-			readBytes = readBytes + n
-			if e != nil {
-				break
-			}
-		}
-	} else {
-		b, err = io.ReadAll(response.Body)
+	if limit <= 0 {
+		return io.ReadAll(response.Body)
 	}
-	return
+	if response.ContentLength > limit {
+		return nil, &contract.ResponseTooLargeError{Limit: limit}
+	}
+
+	b, err = io.ReadAll(io.LimitReader(response.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, &contract.ResponseTooLargeError{Limit: limit}
+	}
+	return b, nil
 }
 
-func addJsonHeader(req *http.Request) {
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
+// xeHeaderInterceptor 透传灰度、链路及全局唯一标识请求头
+func xeHeaderInterceptor(next HttpRoundTripFunc) HttpRoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		addXeHeader(req.Context(), req)
+		return next(req)
+	}
 }
 
 func addXeHeader(ctx context.Context, req *http.Request) {
@@ -427,14 +312,40 @@ func addXeHeader(ctx context.Context, req *http.Request) {
 
 }
 
-func recordLog(req *http.Request, resp **http.Response, params *string, response *[]byte, err *error, beginTime time.Time, logger contract.XiaoeRequestLoggerInterface) {
+// 记录日志时隐藏值的请求头
+var sensitiveHttpHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Signature"}
+
+// redactHttpHeader 隐藏常见凭证请求头及 authHeaders 中鉴权方式设置的请求头
+func redactHttpHeader(header http.Header, authHeaders []string) http.Header {
+	redacted := header.Clone()
+	for _, names := range [][]string{sensitiveHttpHeaders, authHeaders} {
+		for _, name := range names {
+			if redacted.Get(name) != "" {
+				redacted.Set(name, "***")
+			}
+		}
+	}
+	return redacted
+}
+
+func recordLog(req *http.Request, resp **http.Response, params *string, response *[]byte, err *error, attempt *int, beginTime time.Time, logger contract.XiaoeRequestLoggerInterface) {
 	if logger != nil && req != nil {
 		record := contract.XiaoeHttpRequestRecord{}
-		record.Sw8 = req.Header.Get(contract.Sw8Header)
-		record.Sw8Correlation = req.Header.Get(contract.Sw8CorrelationHeader)
-		record.XeTag = req.Header.Get(contract.XeTagHeader)
-		record.TraceId = req.Header.Get(contract.TraceId)
-		record.TargetUrl = req.URL.String()
+		// 优先使用实际发出的请求头，鉴权拦截器在副本上添加的请求头不会写回原请求
+		header := req.Header
+		var authHeaders []string
+		if state := getHttpCallState(req.Context()); state != nil {
+			if sent, names := state.getSentHeader(); sent != nil {
+				header, authHeaders = sent, names
+			}
+		}
+		record.Sw8 = header.Get(contract.Sw8Header)
+		record.Sw8Correlation = header.Get(contract.Sw8CorrelationHeader)
+		record.XeTag = header.Get(contract.XeTagHeader)
+		record.TraceId = header.Get(contract.TraceId)
+		headerByte, _ := json.Marshal(redactHttpHeader(header, authHeaders))
+		record.Header = string(headerByte)
+		record.TargetUrl = req.URL.Redacted()
 		record.Method = req.Method
 		if params != nil {
 			record.Params = *params
@@ -442,6 +353,12 @@ func recordLog(req *http.Request, resp **http.Response, params *string, response
 		if err != nil && *err != nil {
 			record.Msg = (*err).Error()
 		}
+		if attempt != nil {
+			record.Attempt = *attempt
+		}
+		if state := getHttpCallState(req.Context()); state != nil && state.timings != nil {
+			record.DnsCost, record.ConnectCost, record.TlsCost, record.FirstByteCost, record.ConnReused = state.timings.durations()
+		}
 
 		record.ClientIp = network.GetInternalIp()
 		if resp != nil && *resp != nil {
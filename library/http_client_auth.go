@@ -0,0 +1,287 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HttpAuthProviderInterface 请求鉴权，每次尝试发送前调用，可修改请求头
+type HttpAuthProviderInterface interface {
+	Apply(req *http.Request) error
+}
+
+// httpAuthInvalidator 服务端返回401时使缓存的凭证失效
+type httpAuthInvalidator interface {
+	Invalidate()
+}
+
+// StaticHeaderAuth 固定请求头鉴权
+type StaticHeaderAuth struct {
+	Name  string
+	Value string
+}
+
+func NewBearerAuth(token string) *StaticHeaderAuth {
+	return &StaticHeaderAuth{Name: "Authorization", Value: "Bearer " + token}
+}
+
+func NewBasicAuth(username, password string) *StaticHeaderAuth {
+	credential := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return &StaticHeaderAuth{Name: "Authorization", Value: "Basic " + credential}
+}
+
+func (a *StaticHeaderAuth) Apply(req *http.Request) error {
+	req.Header.Set(a.Name, a.Value)
+	return nil
+}
+
+// HmacSigner 对 method/path/query/timestamp/nonce/body 签名
+//
+//	METHOD\nPATH\nRAW_QUERY\nTIMESTAMP\nNONCE\nhex(sha256(body))
+type HmacSigner struct {
+	AppId           string
+	Secret          string
+	AppIdHeader     string           // 默认 X-App-Id
+	TimestampHeader string           // 秒级时间戳，默认 X-Timestamp
+	NonceHeader     string           // 默认 X-Nonce
+	SignatureHeader string           // hex编码的签名，默认 X-Signature
+	Hash            func() hash.Hash // 默认 sha256
+}
+
+func (s *HmacSigner) Apply(req *http.Request) error {
+	body, err := readReplayableBody(req)
+	if err != nil {
+		return fmt.Errorf("hmac sign read body: %w", err)
+	}
+	bodyHash := sha256.Sum256(body)
+
+	nonce := make([]byte, 8)
+	if _, err = rand.Read(nonce); err != nil {
+		return fmt.Errorf("hmac sign nonce: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+
+	hashFunc := s.Hash
+	if hashFunc == nil {
+		hashFunc = sha256.New
+	}
+	mac := hmac.New(hashFunc, []byte(s.Secret))
+	mac.Write([]byte(strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		timestamp,
+		nonceHex,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")))
+
+	req.Header.Set(headerOrDefault(s.AppIdHeader, "X-App-Id"), s.AppId)
+	req.Header.Set(headerOrDefault(s.TimestampHeader, "X-Timestamp"), timestamp)
+	req.Header.Set(headerOrDefault(s.NonceHeader, "X-Nonce"), nonceHex)
+	req.Header.Set(headerOrDefault(s.SignatureHeader, "X-Signature"), hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+func headerOrDefault(name, defaultName string) string {
+	if name == "" {
+		return defaultName
+	}
+	return name
+}
+
+// readReplayableBody 读取请求体用于签名，无法重放的 body 会被读入内存并设置 GetBody
+func readReplayableBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+
+	content, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(content))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+	req.ContentLength = int64(len(content))
+	return content, nil
+}
+
+const defaultTokenRefreshBefore = time.Minute
+
+// OAuth2TokenProvider 通过 client_credentials 获取 access token，过期前自动刷新
+type OAuth2TokenProvider struct {
+	TokenUrl            string
+	ClientId            string
+	ClientSecret        string
+	Scopes              []string
+	RefreshBeforeSecond int          // 提前刷新的时间，默认60s
+	Client              *http.Client // 获取token使用的client，默认超时10s
+
+	lock      sync.Mutex
+	token     string
+	tokenType string
+	expiresAt time.Time
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func (p *OAuth2TokenProvider) Apply(req *http.Request) error {
+	tokenType, token, err := p.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", tokenType+" "+token)
+	return nil
+}
+
+// Token 返回未过期的token，临近过期时刷新，并发调用只会刷新一次
+func (p *OAuth2TokenProvider) Token(ctx context.Context) (tokenType string, token string, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	refreshBefore := time.Duration(p.RefreshBeforeSecond) * time.Second
+	if refreshBefore <= 0 {
+		refreshBefore = defaultTokenRefreshBefore
+	}
+	if p.token != "" && time.Now().Add(refreshBefore).Before(p.expiresAt) {
+		return p.tokenType, p.token, nil
+	}
+
+	tokenResp, err := p.fetch(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	p.token = tokenResp.AccessToken
+	p.tokenType = tokenResp.TokenType
+	if p.tokenType == "" || strings.EqualFold(p.tokenType, "bearer") {
+		p.tokenType = "Bearer"
+	}
+	p.expiresAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	return p.tokenType, p.token, nil
+}
+
+// Invalidate 丢弃缓存的token，下次请求重新获取
+func (p *OAuth2TokenProvider) Invalidate() {
+	p.lock.Lock()
+	p.token = ""
+	p.lock.Unlock()
+}
+
+func (p *OAuth2TokenProvider) fetch(ctx context.Context) (*oauth2TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(p.Scopes) > 0 {
+		form.Set("scope", strings.Join(p.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 token request: %w", err)
+	}
+	req.SetBasicAuth(url.QueryEscape(p.ClientId), url.QueryEscape(p.ClientSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2 token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 错误响应可能包含敏感信息，只返回状态码
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("oauth2 token request: response error, code %d", resp.StatusCode)
+	}
+	tokenResp := &oauth2TokenResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(tokenResp); err != nil {
+		return nil, fmt.Errorf("oauth2 token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("oauth2 token response: empty access_token")
+	}
+	return tokenResp, nil
+}
+
+// authInterceptor 在副本请求上设置鉴权信息，原请求头不变，每次重试都会重新签名
+// 鉴权方式设置或修改的请求头会记录到调用状态中，日志中隐藏其值，因此日志不会记录凭证
+func (c *HttpClient) authInterceptor(next HttpRoundTripFunc) HttpRoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		provider := c.auth
+		state := getHttpCallState(req.Context())
+		if state != nil && state.auth != nil {
+			provider = state.auth
+		}
+		if provider == nil {
+			return next(req)
+		}
+
+		authReq := req.Clone(req.Context())
+		if err := provider.Apply(authReq); err != nil {
+			return nil, fmt.Errorf("http auth: %w", err)
+		}
+		if state != nil {
+			state.setAuthHeaders(changedHeaderNames(req.Header, authReq.Header))
+		}
+		// 签名时可能将 body 读入内存，同步给原请求以便重试重放
+		req.Body, req.GetBody, req.ContentLength = authReq.Body, authReq.GetBody, authReq.ContentLength
+
+		resp, err := next(authReq)
+		if err == nil && resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			if invalidator, ok := provider.(httpAuthInvalidator); ok {
+				invalidator.Invalidate()
+			}
+		}
+		return resp, err
+	}
+}
+
+// changedHeaderNames after 中新增或取值变化的请求头名
+func changedHeaderNames(before, after http.Header) []string {
+	var names []string
+	for name, values := range after {
+		if strings.Join(before.Values(name), "\n") != strings.Join(values, "\n") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Auth 本次请求使用的鉴权方式，覆盖 HttpClientConfig.Auth
+func (r *HttpRequest) Auth(provider HttpAuthProviderInterface) *HttpRequest {
+	r.auth = provider
+	return r
+}
@@ -0,0 +1,254 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ServiceScheme 逻辑服务地址的scheme，例如 svc://user-center/users/1
+const ServiceScheme = "svc"
+
+// 负载均衡策略
+const (
+	BalanceRoundRobin   = "round_robin"
+	BalanceWeighted     = "weighted"
+	BalanceLeastPending = "least_pending"
+)
+
+const (
+	defaultEjectFailures   = 5
+	defaultEjectDuration   = 30 * time.Second
+	defaultMaxEjectPercent = 50
+)
+
+// httpLoadBalancer 按逻辑服务名选择实例，并被动摘除连续失败的实例
+type httpLoadBalancer struct {
+	discovery       ServiceDiscoveryInterface
+	policy          string
+	targetScheme    string
+	ejectFailures   int
+	ejectDuration   time.Duration
+	maxEjectPercent int
+	logger          *zap.Logger
+
+	lock     sync.Mutex
+	services map[string]*balancedService
+}
+
+type balancedService struct {
+	counter   uint64
+	instances map[string]*balancedInstance
+}
+
+type balancedInstance struct {
+	addr          string
+	weight        int
+	currentWeight int // 平滑加权轮询
+	pending       int64
+	failures      int
+	ejectedUntil  time.Time
+}
+
+func newHttpLoadBalancer(conf *HttpLoadBalanceConfig) *httpLoadBalancer {
+	if conf == nil || conf.Discovery == nil {
+		return nil
+	}
+
+	b := &httpLoadBalancer{
+		discovery:       conf.Discovery,
+		policy:          conf.Policy,
+		targetScheme:    conf.TargetScheme,
+		ejectFailures:   conf.EjectFailures,
+		ejectDuration:   time.Duration(conf.EjectSecond) * time.Second,
+		maxEjectPercent: conf.MaxEjectPercent,
+		logger:          conf.Logger,
+		services:        make(map[string]*balancedService),
+	}
+	if b.policy == "" {
+		b.policy = BalanceRoundRobin
+	}
+	if b.targetScheme == "" {
+		b.targetScheme = "http"
+	}
+	if b.ejectFailures <= 0 {
+		b.ejectFailures = defaultEjectFailures
+	}
+	if b.ejectDuration <= 0 {
+		b.ejectDuration = defaultEjectDuration
+	}
+	if b.maxEjectPercent <= 0 || b.maxEjectPercent > 100 {
+		b.maxEjectPercent = defaultMaxEjectPercent
+	}
+	return b
+}
+
+// pick 选出一个可用实例
+func (b *httpLoadBalancer) pick(req *http.Request, service string) (*balancedInstance, error) {
+	discovered, err := b.discovery.Instances(req.Context(), service)
+	if err != nil {
+		return nil, fmt.Errorf("discover service %s: %w", service, err)
+	}
+	if len(discovered) == 0 {
+		return nil, fmt.Errorf("service %s has no instance", service)
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	svc := b.syncInstances(service, discovered)
+	now := time.Now()
+	candidates := make([]*balancedInstance, 0, len(discovered))
+	ejected := 0
+	for _, instance := range discovered {
+		balanced := svc.instances[instance.Addr]
+		if balanced.ejectedUntil.After(now) {
+			ejected++
+			continue
+		}
+		candidates = append(candidates, balanced)
+	}
+	// 摘除比例超过上限或全部被摘除时忽略摘除状态，避免流量全部打到少数实例
+	if len(candidates) == 0 || ejected*100 > len(discovered)*b.maxEjectPercent {
+		candidates = candidates[:0]
+		for _, instance := range discovered {
+			candidates = append(candidates, svc.instances[instance.Addr])
+		}
+	}
+
+	var picked *balancedInstance
+	switch b.policy {
+	case BalanceWeighted:
+		picked = pickWeighted(candidates)
+	case BalanceLeastPending:
+		picked = pickLeastPending(candidates, svc.counter)
+	default:
+		picked = candidates[svc.counter%uint64(len(candidates))]
+	}
+	svc.counter++
+	atomic.AddInt64(&picked.pending, 1)
+	return picked, nil
+}
+
+// syncInstances 同步服务发现的实例列表，保留已有实例的统计状态，调用方需持有锁
+func (b *httpLoadBalancer) syncInstances(service string, discovered []ServiceInstance) *balancedService {
+	svc, ok := b.services[service]
+	if !ok {
+		svc = &balancedService{instances: make(map[string]*balancedInstance)}
+		b.services[service] = svc
+	}
+
+	alive := make(map[string]struct{}, len(discovered))
+	for _, instance := range discovered {
+		alive[instance.Addr] = struct{}{}
+		weight := instance.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		if balanced, ok := svc.instances[instance.Addr]; ok {
+			balanced.weight = weight
+			continue
+		}
+		svc.instances[instance.Addr] = &balancedInstance{addr: instance.Addr, weight: weight}
+	}
+	for addr := range svc.instances {
+		if _, ok := alive[addr]; !ok {
+			delete(svc.instances, addr)
+		}
+	}
+	return svc
+}
+
+// pickWeighted 平滑加权轮询
+func pickWeighted(candidates []*balancedInstance) *balancedInstance {
+	var picked *balancedInstance
+	total := 0
+	for _, instance := range candidates {
+		instance.currentWeight += instance.weight
+		total += instance.weight
+		if picked == nil || instance.currentWeight > picked.currentWeight {
+			picked = instance
+		}
+	}
+	picked.currentWeight -= total
+	return picked
+}
+
+// pickLeastPending 选择进行中请求最少的实例，相同时轮询
+func pickLeastPending(candidates []*balancedInstance, counter uint64) *balancedInstance {
+	offset := int(counter % uint64(len(candidates)))
+	picked := candidates[offset]
+	for i := 1; i < len(candidates); i++ {
+		instance := candidates[(offset+i)%len(candidates)]
+		if atomic.LoadInt64(&instance.pending) < atomic.LoadInt64(&picked.pending) {
+			picked = instance
+		}
+	}
+	return picked
+}
+
+// release 请求结束，根据结果更新实例的被动健康状态
+// 调用方取消或到达调用方的截止时间不计入失败，http.Client.Timeout、HttpRequest.Timeout 等超时仍计入失败
+func (b *httpLoadBalancer) release(ctx context.Context, service string, instance *balancedInstance, resp *http.Response, err error) {
+	atomic.AddInt64(&instance.pending, -1)
+	if err != nil && isCallerCancelled(ctx) {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err == nil && resp != nil && resp.StatusCode < http.StatusInternalServerError {
+		instance.failures = 0
+		return
+	}
+
+	instance.failures++
+	if instance.failures < b.ejectFailures {
+		return
+	}
+	instance.failures = 0
+	instance.ejectedUntil = time.Now().Add(b.ejectDuration)
+	if b.logger != nil {
+		b.logger.Warn("http load balancer eject instance",
+			zap.String("service", service),
+			zap.String("addr", instance.addr),
+			zap.Duration("duration", b.ejectDuration),
+			zap.Error(err))
+	}
+}
+
+// loadBalanceInterceptor 将 svc://service/path 改写为选中实例的地址，每次尝试重新选择实例
+func (c *HttpClient) loadBalanceInterceptor(next HttpRoundTripFunc) HttpRoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if req.URL.Scheme != ServiceScheme {
+			return next(req)
+		}
+		if c.balancer == nil {
+			return nil, fmt.Errorf("service discovery is not configured for %s", req.URL.String())
+		}
+
+		service := req.URL.Host
+		instance, err := c.balancer.pick(req, service)
+		if err != nil {
+			return nil, err
+		}
+
+		// 浅拷贝请求，header 与原请求共享，便于外层拦截器读取链路信息
+		outReq := new(http.Request)
+		*outReq = *req
+		targetUrl := *req.URL
+		targetUrl.Scheme = c.balancer.targetScheme
+		targetUrl.Host = instance.addr
+		outReq.URL = &targetUrl
+		outReq.Host = ""
+
+		resp, err := next(outReq)
+		c.balancer.release(req.Context(), service, instance, resp, err)
+		return resp, err
+	}
+}
@@ -0,0 +1,399 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ctl5563096/base/contract"
+	"go.uber.org/zap"
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitStatus 单个host的熔断状态快照
+type CircuitStatus struct {
+	Host      string
+	State     CircuitState
+	Requests  int       // 当前窗口请求数
+	Failures  int       // 当前窗口失败数
+	ChangedAt time.Time // 最近一次状态变更时间
+}
+
+const (
+	defaultBreakerWindow           = 10 * time.Second
+	defaultBreakerBucketNums       = 10
+	defaultBreakerMinRequests      = 20
+	defaultBreakerErrorRatePercent = 50
+	defaultBreakerOpenDuration     = 5 * time.Second
+	defaultBreakerHalfOpenRequests = 1
+)
+
+// httpCircuitBreakers 按host管理熔断器
+type httpCircuitBreakers struct {
+	window           time.Duration
+	bucketNums       int
+	minRequests      int
+	errorRatePercent int
+	openDuration     time.Duration
+	halfOpenRequests int
+	failureCodes     map[int]struct{}
+	logger           *zap.Logger
+
+	mu       sync.RWMutex
+	breakers map[string]*circuitBreaker
+}
+
+func newHttpCircuitBreakers(conf *HttpCircuitBreakerConfig) *httpCircuitBreakers {
+	if conf == nil || !conf.Enable {
+		return nil
+	}
+
+	b := &httpCircuitBreakers{
+		window:           time.Duration(conf.WindowSecond) * time.Second,
+		bucketNums:       conf.BucketNums,
+		minRequests:      conf.MinRequests,
+		errorRatePercent: conf.ErrorRatePercent,
+		openDuration:     time.Duration(conf.OpenSecond) * time.Second,
+		halfOpenRequests: conf.HalfOpenMaxRequests,
+		failureCodes:     make(map[int]struct{}),
+		logger:           conf.Logger,
+		breakers:         make(map[string]*circuitBreaker),
+	}
+	if b.window <= 0 {
+		b.window = defaultBreakerWindow
+	}
+	if b.bucketNums <= 0 {
+		b.bucketNums = defaultBreakerBucketNums
+	}
+	if b.minRequests <= 0 {
+		b.minRequests = defaultBreakerMinRequests
+	}
+	if b.errorRatePercent <= 0 || b.errorRatePercent > 100 {
+		b.errorRatePercent = defaultBreakerErrorRatePercent
+	}
+	if b.openDuration <= 0 {
+		b.openDuration = defaultBreakerOpenDuration
+	}
+	if b.halfOpenRequests <= 0 {
+		b.halfOpenRequests = defaultBreakerHalfOpenRequests
+	}
+	for _, code := range conf.FailureStatusCodes {
+		b.failureCodes[code] = struct{}{}
+	}
+	return b
+}
+
+func (b *httpCircuitBreakers) get(host string) *circuitBreaker {
+	b.mu.RLock()
+	breaker, ok := b.breakers[host]
+	b.mu.RUnlock()
+	if ok {
+		return breaker
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if breaker, ok = b.breakers[host]; ok {
+		return breaker
+	}
+	breaker = &circuitBreaker{
+		host:      host,
+		parent:    b,
+		buckets:   make([]breakerBucket, b.bucketNums),
+		changedAt: time.Now(),
+	}
+	b.breakers[host] = breaker
+	return breaker
+}
+
+// 请求结果
+type breakerOutcome int
+
+const (
+	breakerSuccess breakerOutcome = iota
+	breakerFailure
+	breakerIgnored // 调用方取消，不计入统计
+)
+
+// breakerTicket 放行时的熔断器状态，上报时只统计同一状态周期内放行的请求
+type breakerTicket struct {
+	generation uint64
+	probe      bool // 半开状态下放行的探测请求
+}
+
+// allow 熔断时返回 *contract.CircuitOpenError
+func (b *httpCircuitBreakers) allow(host string) (breakerTicket, error) {
+	if b == nil {
+		return breakerTicket{}, nil
+	}
+	return b.get(host).allow()
+}
+
+func (b *httpCircuitBreakers) report(ctx context.Context, host string, ticket breakerTicket, resp *http.Response, err error) {
+	if b == nil {
+		return
+	}
+	b.get(host).report(ticket, b.outcome(ctx, resp, err))
+}
+
+func (b *httpCircuitBreakers) outcome(ctx context.Context, resp *http.Response, err error) breakerOutcome {
+	if err != nil {
+		// 调用方主动取消或到达调用方自己的截止时间不计入统计，HttpRequest.Timeout 等超时计入失败
+		if isCallerCancelled(ctx) || errors.Is(err, context.Canceled) {
+			return breakerIgnored
+		}
+		return breakerFailure
+	}
+	if resp == nil {
+		return breakerFailure
+	}
+	if len(b.failureCodes) == 0 {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return breakerFailure
+		}
+		return breakerSuccess
+	}
+	if _, ok := b.failureCodes[resp.StatusCode]; ok {
+		return breakerFailure
+	}
+	return breakerSuccess
+}
+
+func (b *httpCircuitBreakers) statuses() []CircuitStatus {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.RLock()
+	breakers := make([]*circuitBreaker, 0, len(b.breakers))
+	for _, breaker := range b.breakers {
+		breakers = append(breakers, breaker)
+	}
+	b.mu.RUnlock()
+
+	statuses := make([]CircuitStatus, 0, len(breakers))
+	for _, breaker := range breakers {
+		statuses = append(statuses, breaker.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Host < statuses[j].Host
+	})
+	return statuses
+}
+
+func (b *httpCircuitBreakers) bucketDuration() time.Duration {
+	return b.window / time.Duration(b.bucketNums)
+}
+
+type breakerBucket struct {
+	start    int64 // 分桶起始时间(UnixNano)
+	requests int
+	failures int
+}
+
+// circuitBreaker 单host熔断器，滚动窗口统计错误率
+type circuitBreaker struct {
+	host   string
+	parent *httpCircuitBreakers
+
+	mu               sync.Mutex
+	state            CircuitState
+	generation       uint64 // 每次状态变更加1
+	buckets          []breakerBucket
+	openedAt         time.Time
+	changedAt        time.Time
+	halfOpenInflight int
+	halfOpenSuccess  int
+}
+
+func (cb *circuitBreaker) allow() (breakerTicket, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	switch cb.state {
+	case CircuitOpen:
+		retryAfter := cb.openedAt.Add(cb.parent.openDuration).Sub(now)
+		if retryAfter > 0 {
+			return breakerTicket{}, &contract.CircuitOpenError{Host: cb.host, RetryAfter: retryAfter}
+		}
+		cb.setState(CircuitHalfOpen, now)
+		fallthrough
+	case CircuitHalfOpen:
+		if cb.halfOpenInflight >= cb.parent.halfOpenRequests {
+			return breakerTicket{}, &contract.CircuitOpenError{Host: cb.host}
+		}
+		cb.halfOpenInflight++
+		return breakerTicket{generation: cb.generation, probe: true}, nil
+	}
+	return breakerTicket{generation: cb.generation}, nil
+}
+
+// report 状态已变更时放行的请求结果不再统计
+func (cb *circuitBreaker) report(ticket breakerTicket, outcome breakerOutcome) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if ticket.generation != cb.generation {
+		return
+	}
+	now := time.Now()
+	switch cb.state {
+	case CircuitHalfOpen:
+		if !ticket.probe {
+			return
+		}
+		// 释放探测名额，取消的探测不计入结果
+		cb.halfOpenInflight--
+		switch outcome {
+		case breakerIgnored:
+			return
+		case breakerFailure:
+			cb.open(now)
+			return
+		}
+		cb.halfOpenSuccess++
+		if cb.halfOpenSuccess >= cb.parent.halfOpenRequests {
+			cb.resetBuckets()
+			cb.setState(CircuitClosed, now)
+		}
+	case CircuitClosed:
+		if outcome == breakerIgnored {
+			return
+		}
+		bucket := cb.currentBucket(now)
+		bucket.requests++
+		if outcome == breakerFailure {
+			bucket.failures++
+		}
+		requests, failures := cb.counts(now)
+		if requests >= cb.parent.minRequests && failures*100 >= requests*cb.parent.errorRatePercent {
+			cb.open(now)
+		}
+	}
+}
+
+func (cb *circuitBreaker) open(now time.Time) {
+	cb.openedAt = now
+	cb.setState(CircuitOpen, now)
+}
+
+func (cb *circuitBreaker) setState(state CircuitState, now time.Time) {
+	if cb.state == state {
+		return
+	}
+	from := cb.state
+	cb.state = state
+	cb.generation++
+	cb.changedAt = now
+	cb.halfOpenInflight = 0
+	cb.halfOpenSuccess = 0
+
+	if cb.parent.logger != nil {
+		requests, failures := cb.counts(now)
+		cb.parent.logger.Warn("http circuit breaker state changed",
+			zap.String("host", cb.host),
+			zap.String("from", from.String()),
+			zap.String("to", state.String()),
+			zap.Int("requests", requests),
+			zap.Int("failures", failures))
+	}
+}
+
+func (cb *circuitBreaker) currentBucket(now time.Time) *breakerBucket {
+	duration := int64(cb.parent.bucketDuration())
+	start := now.UnixNano() / duration * duration
+	bucket := &cb.buckets[(start/duration)%int64(len(cb.buckets))]
+	if bucket.start != start {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+func (cb *circuitBreaker) counts(now time.Time) (requests, failures int) {
+	windowStart := now.Add(-cb.parent.window).UnixNano()
+	for _, bucket := range cb.buckets {
+		if bucket.start > windowStart {
+			requests += bucket.requests
+			failures += bucket.failures
+		}
+	}
+	return
+}
+
+func (cb *circuitBreaker) resetBuckets() {
+	for i := range cb.buckets {
+		cb.buckets[i] = breakerBucket{}
+	}
+}
+
+func (cb *circuitBreaker) status() CircuitStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := time.Now()
+	state := cb.state
+	// 熔断时长已过，下次请求将进入半开
+	if state == CircuitOpen && now.Sub(cb.openedAt) >= cb.parent.openDuration {
+		state = CircuitHalfOpen
+	}
+	requests, failures := cb.counts(now)
+	return CircuitStatus{
+		Host:      cb.host,
+		State:     state,
+		Requests:  requests,
+		Failures:  failures,
+		ChangedAt: cb.changedAt,
+	}
+}
+
+// circuitBreakerInterceptor 目标host熔断时直接返回 *contract.CircuitOpenError，不发出请求
+func (c *HttpClient) circuitBreakerInterceptor(next HttpRoundTripFunc) HttpRoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		ticket, err := c.breakers.allow(req.URL.Host)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := next(req)
+		c.breakers.report(req.Context(), req.URL.Host, ticket, resp, err)
+		return resp, err
+	}
+}
+
+// CircuitStatuses 返回所有已访问host的熔断状态，未开启熔断时返回nil
+func (c *HttpClient) CircuitStatuses() []CircuitStatus {
+	return c.breakers.statuses()
+}
+
+// DegradedHosts 返回当前处于熔断或半开状态的host
+func (c *HttpClient) DegradedHosts() (hosts []string) {
+	for _, status := range c.breakers.statuses() {
+		if status.State != CircuitClosed {
+			hosts = append(hosts, status.Host)
+		}
+	}
+	return
+}
@@ -0,0 +1,147 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ctl5563096/base/contract"
+)
+
+const testBreakerHost = "api.example.com"
+
+func newTestBreakers() *httpCircuitBreakers {
+	b := newHttpCircuitBreakers(&HttpCircuitBreakerConfig{
+		Enable:              true,
+		MinRequests:         4,
+		ErrorRatePercent:    50,
+		HalfOpenMaxRequests: 1,
+	})
+	// OpenSecond 最小1s，测试中缩短
+	b.openDuration = 20 * time.Millisecond
+	return b
+}
+
+func reportTestStatus(t *testing.T, b *httpCircuitBreakers, statusCode int) {
+	t.Helper()
+	ticket, err := b.allow(testBreakerHost)
+	if err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	b.report(context.Background(), testBreakerHost, ticket, &http.Response{StatusCode: statusCode}, nil)
+}
+
+func assertCircuitState(t *testing.T, b *httpCircuitBreakers, want CircuitState) {
+	t.Helper()
+	if got := b.get(testBreakerHost).status().State; got != want {
+		t.Fatalf("state %s, want %s", got, want)
+	}
+}
+
+// openTestBreaker 错误率达到50%后熔断
+func openTestBreaker(t *testing.T, b *httpCircuitBreakers) {
+	t.Helper()
+	reportTestStatus(t, b, http.StatusOK)
+	reportTestStatus(t, b, http.StatusOK)
+	reportTestStatus(t, b, http.StatusBadGateway)
+	assertCircuitState(t, b, CircuitClosed)
+	reportTestStatus(t, b, http.StatusBadGateway)
+	assertCircuitState(t, b, CircuitOpen)
+
+	_, err := b.allow(testBreakerHost)
+	var openErr *contract.CircuitOpenError
+	if !errors.As(err, &openErr) || openErr.RetryAfter <= 0 {
+		t.Fatalf("allow while open: %v", err)
+	}
+}
+
+func TestCircuitBreakerProbeSuccessCloses(t *testing.T) {
+	b := newTestBreakers()
+	openTestBreaker(t, b)
+
+	time.Sleep(b.openDuration)
+	probe, err := b.allow(testBreakerHost)
+	if err != nil || !probe.probe {
+		t.Fatalf("probe ticket %+v, err %v", probe, err)
+	}
+	// 探测名额已用完
+	if _, err = b.allow(testBreakerHost); err == nil {
+		t.Fatal("second request allowed while half-open")
+	}
+
+	b.report(context.Background(), testBreakerHost, probe, &http.Response{StatusCode: http.StatusOK}, nil)
+	assertCircuitState(t, b, CircuitClosed)
+	if status := b.get(testBreakerHost).status(); status.Requests != 0 || status.Failures != 0 {
+		t.Fatalf("window not reset after close: %+v", status)
+	}
+}
+
+func TestCircuitBreakerProbeFailureReopens(t *testing.T) {
+	b := newTestBreakers()
+	openTestBreaker(t, b)
+
+	time.Sleep(b.openDuration)
+	probe, err := b.allow(testBreakerHost)
+	if err != nil {
+		t.Fatalf("allow probe: %v", err)
+	}
+	b.report(context.Background(), testBreakerHost, probe, nil, errors.New("connection refused"))
+	assertCircuitState(t, b, CircuitOpen)
+}
+
+func TestCircuitBreakerIgnoresStaleTicket(t *testing.T) {
+	b := newTestBreakers()
+	stale, err := b.allow(testBreakerHost)
+	if err != nil {
+		t.Fatalf("allow: %v", err)
+	}
+	openTestBreaker(t, b)
+
+	time.Sleep(b.openDuration)
+	if _, err = b.allow(testBreakerHost); err != nil {
+		t.Fatalf("allow probe: %v", err)
+	}
+	// 熔断前放行的请求在半开时才返回，不能当作探测结果
+	b.report(context.Background(), testBreakerHost, stale, &http.Response{StatusCode: http.StatusOK}, nil)
+	assertCircuitState(t, b, CircuitHalfOpen)
+}
+
+func TestCircuitBreakerOutcome(t *testing.T) {
+	b := newTestBreakers()
+
+	caller, cancel := context.WithCancel(context.Background())
+	ctx := withHttpCallState(caller, &httpCallState{caller: caller})
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, time.Nanosecond)
+	defer timeoutCancel()
+	<-timeoutCtx.Done()
+
+	// HttpRequest.Timeout 超时计入失败
+	if outcome := b.outcome(timeoutCtx, nil, context.DeadlineExceeded); outcome != breakerFailure {
+		t.Fatalf("request timeout outcome %d, want failure", outcome)
+	}
+	if outcome := b.outcome(ctx, &http.Response{StatusCode: http.StatusServiceUnavailable}, nil); outcome != breakerFailure {
+		t.Fatalf("503 outcome %d, want failure", outcome)
+	}
+	if outcome := b.outcome(ctx, &http.Response{StatusCode: http.StatusNotFound}, nil); outcome != breakerSuccess {
+		t.Fatalf("404 outcome %d, want success", outcome)
+	}
+
+	// 调用方取消不计入统计
+	cancel()
+	if outcome := b.outcome(timeoutCtx, nil, context.Canceled); outcome != breakerIgnored {
+		t.Fatalf("caller cancel outcome %d, want ignored", outcome)
+	}
+	for i := 0; i < 4; i++ {
+		ticket, err := b.allow(testBreakerHost)
+		if err != nil {
+			t.Fatalf("allow: %v", err)
+		}
+		b.report(ctx, testBreakerHost, ticket, nil, context.Canceled)
+	}
+	assertCircuitState(t, b, CircuitClosed)
+	if status := b.get(testBreakerHost).status(); status.Requests != 0 {
+		t.Fatalf("cancelled requests counted: %+v", status)
+	}
+}
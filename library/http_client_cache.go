@@ -0,0 +1,426 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ctl5563096/base/contract"
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultCacheStaleTTL      = 10 * time.Minute
+	defaultCacheMaxEntryBytes = 1024 * 1024
+	httpCacheKeyPrefix        = "http_cache:"
+)
+
+// HttpCacheEntry 缓存的响应
+type HttpCacheEntry struct {
+	StatusCode int               `json:"status_code"`
+	Header     http.Header       `json:"header"`
+	Body       []byte            `json:"body"`
+	Vary       map[string]string `json:"vary,omitempty"` // 响应 Vary 中各请求头在缓存时的取值
+	StoredAt   time.Time         `json:"stored_at"`
+	FreshUntil time.Time         `json:"fresh_until"` // 在此之前无需向服务端确认
+}
+
+func (e *HttpCacheEntry) isFresh(now time.Time) bool {
+	return now.Before(e.FreshUntil)
+}
+
+// matchVary 请求在 Vary 请求头上的取值与缓存时一致
+func (e *HttpCacheEntry) matchVary(req *http.Request) bool {
+	for name, value := range e.Vary {
+		if strings.Join(req.Header.Values(name), ",") != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *HttpCacheEntry) canRevalidate() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// toResponse 根据缓存生成响应，每次返回新的 body
+func (e *HttpCacheEntry) toResponse(req *http.Request, cacheStatus string) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(time.Since(e.StoredAt).Seconds())))
+	header.Set("X-Cache", cacheStatus)
+	return &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// HttpCacheStorageInterface 响应缓存存储
+type HttpCacheStorageInterface interface {
+	Get(ctx context.Context, key string) (entry *HttpCacheEntry, ok bool, err error)
+	Set(ctx context.Context, key string, entry *HttpCacheEntry, ttl time.Duration) error
+}
+
+// LocalCacheStorage 基于进程内 LocalCache 的缓存存储
+type LocalCacheStorage struct {
+	cache *LocalCache
+}
+
+func NewLocalCacheStorage(cache *LocalCache) *LocalCacheStorage {
+	return &LocalCacheStorage{cache: cache}
+}
+
+func (s *LocalCacheStorage) Get(ctx context.Context, key string) (*HttpCacheEntry, bool, error) {
+	val, ok := s.cache.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	entry, ok := val.(*HttpCacheEntry)
+	return entry, ok, nil
+}
+
+func (s *LocalCacheStorage) Set(ctx context.Context, key string, entry *HttpCacheEntry, ttl time.Duration) error {
+	return s.cache.Put(key, entry, ttl)
+}
+
+// RedisCacheStorage 基于 RedisClient 的缓存存储，多副本间共享
+type RedisCacheStorage struct {
+	client *RedisClient
+}
+
+func NewRedisCacheStorage(client *RedisClient) *RedisCacheStorage {
+	return &RedisCacheStorage{client: client}
+}
+
+func (s *RedisCacheStorage) Get(ctx context.Context, key string) (*HttpCacheEntry, bool, error) {
+	content, err := s.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	entry := &HttpCacheEntry{}
+	if err = json.Unmarshal(content, entry); err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+func (s *RedisCacheStorage) Set(ctx context.Context, key string, entry *HttpCacheEntry, ttl time.Duration) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, key, content, ttl).Err()
+}
+
+// httpResponseCache 缓存 GET 请求的响应，并合并相同key的并发请求
+type httpResponseCache struct {
+	storage       HttpCacheStorageInterface
+	defaultTTL    time.Duration
+	staleTTL      time.Duration
+	maxEntryBytes int
+	group         singleflight.Group
+}
+
+func newHttpResponseCache(conf *HttpCacheConfig) *httpResponseCache {
+	if conf == nil || conf.Storage == nil {
+		return nil
+	}
+
+	cache := &httpResponseCache{
+		storage:       conf.Storage,
+		defaultTTL:    time.Duration(conf.DefaultTTLSecond) * time.Second,
+		staleTTL:      time.Duration(conf.StaleTTLSecond) * time.Second,
+		maxEntryBytes: conf.MaxEntryBytes,
+	}
+	if cache.staleTTL <= 0 {
+		cache.staleTTL = defaultCacheStaleTTL
+	}
+	if cache.maxEntryBytes <= 0 {
+		cache.maxEntryBytes = defaultCacheMaxEntryBytes
+	}
+	return cache
+}
+
+// 加入缓存key的请求头，不同取值的响应互不共享
+var httpCacheKeyHeaders = []string{"Accept", "Authorization", "Cookie", contract.XeTagHeader}
+
+// requestKey 缓存与合并请求使用的key，由地址与 Accept、鉴权、灰度请求头组成，请求头取值只保留摘要
+func (cache *httpResponseCache) requestKey(req *http.Request, state *httpCallState) string {
+	key := req.URL.String()
+	if state != nil && state.cacheKey != "" {
+		key = state.cacheKey
+	}
+
+	hash := sha256.New()
+	for _, name := range httpCacheKeyHeaders {
+		_, _ = fmt.Fprintf(hash, "%s=%s\n", name, strings.Join(req.Header.Values(name), ","))
+	}
+	// 单个请求指定的鉴权方式不同，响应也不共享
+	if state != nil && state.auth != nil {
+		_, _ = fmt.Fprintf(hash, "auth=%p\n", state.auth)
+	}
+	return httpCacheKeyPrefix + key + "#" + hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// fetchResult singleflight 共享的结果，resp 不为nil时为不可缓存的响应，只交给发起请求的调用方
+type fetchResult struct {
+	entry       *HttpCacheEntry
+	cacheStatus string
+	resp        *http.Response
+}
+
+// cacheInterceptor 对 GET 请求按 Cache-Control/ETag/Last-Modified/Vary 缓存响应，过期后条件请求重新验证
+// 流式读取的请求不经过缓存，不可缓存的响应不会被读入内存，也不会共享给合并等待的调用方
+func (c *HttpClient) cacheInterceptor(next HttpRoundTripFunc) HttpRoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		cache := c.cache
+		state := getHttpCallState(req.Context())
+		if cache == nil || req.Method != http.MethodGet || (state != nil && (state.noCache || state.stream)) {
+			return next(req)
+		}
+		reqDirectives := parseCacheControl(req.Header.Get("Cache-Control"))
+		if _, ok := reqDirectives["no-store"]; ok {
+			return next(req)
+		}
+
+		key := cache.requestKey(req, state)
+		entry, ok, _ := cache.storage.Get(req.Context(), key)
+		if !ok || !entry.matchVary(req) {
+			entry = nil
+		} else if _, noCache := reqDirectives["no-cache"]; !noCache && entry.isFresh(time.Now()) {
+			return entry.toResponse(req, "HIT"), nil
+		}
+
+		// 只有发起请求的调用方会执行该函数
+		leader := false
+		ch := cache.group.DoChan(key, func() (interface{}, error) {
+			leader = true
+			return cache.fetch(next, req, key, entry)
+		})
+
+		select {
+		case <-req.Context().Done():
+			// 不再等待结果，发起方独占的响应体在后台关闭
+			go func() {
+				res := <-ch
+				if result, ok := res.Val.(*fetchResult); ok && leader && result.resp != nil {
+					_ = result.resp.Body.Close()
+				}
+			}()
+			return nil, req.Context().Err()
+		case res := <-ch:
+			if res.Err != nil {
+				// 发起方被取消时，其它调用方自行请求
+				if !leader && isContextError(res.Err) {
+					return next(req)
+				}
+				return nil, res.Err
+			}
+			result := res.Val.(*fetchResult)
+			if result.resp != nil {
+				if leader {
+					return result.resp, nil
+				}
+				return next(req)
+			}
+			if !leader && !result.entry.matchVary(req) {
+				return next(req)
+			}
+			return result.entry.toResponse(req, result.cacheStatus), nil
+		}
+	}
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// fetch 请求服务端并更新缓存，有可用缓存时发送条件请求
+// 确认响应可缓存且大小不超过 MaxEntryBytes 后才读取响应体
+func (cache *httpResponseCache) fetch(next HttpRoundTripFunc, req *http.Request, key string, cached *HttpCacheEntry) (*fetchResult, error) {
+	if cached != nil && cached.canRevalidate() {
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := next(req)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		// 缓存条目可能被并发读取，更新时复制一份
+		refreshed := *cached
+		refreshed.Header = cached.Header.Clone()
+		for _, name := range []string{"Cache-Control", "Expires", "ETag", "Last-Modified", "Date", "Vary"} {
+			if value := resp.Header.Get(name); value != "" {
+				refreshed.Header.Set(name, value)
+			}
+		}
+		refreshed.StoredAt = now
+		if freshness, ok := cache.freshness(refreshed.Header, now); ok {
+			refreshed.FreshUntil = now.Add(freshness)
+			_ = cache.storage.Set(req.Context(), key, &refreshed, freshness+cache.staleTTL)
+		}
+		return &fetchResult{entry: &refreshed, cacheStatus: "REVALIDATED"}, nil
+	}
+
+	freshness, cacheable := cache.freshness(resp.Header, now)
+	vary, varyAll := parseVary(resp.Header)
+	if resp.StatusCode != http.StatusOK || !cacheable || varyAll || resp.ContentLength > int64(cache.maxEntryBytes) {
+		return &fetchResult{resp: resp}, nil
+	}
+
+	// 多读一个字节用于判断是否超过单条上限
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(cache.maxEntryBytes)+1))
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > cache.maxEntryBytes {
+		// 已读取的部分与剩余响应体拼接后交给发起方
+		resp.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return &fetchResult{resp: resp}, nil
+	}
+	_ = resp.Body.Close()
+
+	entry := &HttpCacheEntry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		Vary:       varyValues(req, vary),
+		StoredAt:   now,
+		FreshUntil: now.Add(freshness),
+	}
+	_ = cache.storage.Set(req.Context(), key, entry, freshness+cache.staleTTL)
+	return &fetchResult{entry: entry, cacheStatus: "MISS"}, nil
+}
+
+// replayBody 重新拼接已读取部分的响应体
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// parseVary 解析响应的 Vary 请求头名，包含 * 时不可缓存
+func parseVary(header http.Header) (names []string, all bool) {
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return nil, true
+			}
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+	return names, false
+}
+
+func varyValues(req *http.Request, names []string) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		values[name] = strings.Join(req.Header.Values(name), ",")
+	}
+	return values
+}
+
+// freshness 计算响应可直接使用的时长，返回false表示不可缓存
+func (cache *httpResponseCache) freshness(header http.Header, now time.Time) (time.Duration, bool) {
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return 0, false
+	}
+	if _, ok := directives["private"]; ok {
+		return 0, false
+	}
+	if _, ok := directives["no-cache"]; ok {
+		return 0, true
+	}
+	if maxAge, ok := directives["s-maxage"]; ok {
+		if seconds, err := strconv.Atoi(maxAge); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	if maxAge, ok := directives["max-age"]; ok {
+		if seconds, err := strconv.Atoi(maxAge); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		if expiresAt, err := http.ParseTime(expires); err == nil {
+			if expiresAt.Before(now) {
+				return 0, true
+			}
+			return expiresAt.Sub(now), true
+		}
+		return 0, true
+	}
+	if header.Get("ETag") != "" || header.Get("Last-Modified") != "" {
+		return cache.defaultTTL, true
+	}
+	if cache.defaultTTL > 0 {
+		return cache.defaultTTL, true
+	}
+	return 0, false
+}
+
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, val := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, val = part[:i], strings.Trim(part[i+1:], "\"")
+		}
+		directives[strings.ToLower(name)] = val
+	}
+	return directives
+}
+
+// CacheKey 自定义缓存key，默认使用完整URL，Accept、鉴权与灰度请求头仍会区分缓存
+func (r *HttpRequest) CacheKey(key string) *HttpRequest {
+	r.cacheKey = key
+	return r
+}
+
+// NoCache 本次请求不读写缓存
+func (r *HttpRequest) NoCache() *HttpRequest {
+	r.noCache = true
+	return r
+}
@@ -0,0 +1,272 @@
+package library
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// HttpVersion 可选值
+const (
+	HttpVersion2   = "2"   // TLS 连接强制尝试 HTTP/2
+	HttpVersionH2C = "h2c" // 明文 HTTP/2，仅用于支持 h2c 的服务
+)
+
+// httpConnTimings 单次尝试的连接各阶段耗时
+type httpConnTimings struct {
+	lock         sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+
+	dns       time.Duration
+	connect   time.Duration
+	tls       time.Duration
+	firstByte time.Duration // 从开始获取连接到收到响应首字节
+	reused    bool
+}
+
+func (t *httpConnTimings) clientTrace(pool *httpPoolStats, gotConn func(host string)) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.lock.Lock()
+			t.dnsStart = time.Now()
+			t.lock.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.lock.Lock()
+			t.dns = time.Since(t.dnsStart)
+			t.lock.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			t.lock.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.lock.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err != nil {
+				return
+			}
+			t.lock.Lock()
+			t.connect = time.Since(t.connectStart)
+			t.lock.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.lock.Lock()
+			t.tlsStart = time.Now()
+			t.lock.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.lock.Lock()
+			t.tls = time.Since(t.tlsStart)
+			t.lock.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.lock.Lock()
+			t.reused = info.Reused
+			t.lock.Unlock()
+			if host, ok := pool.hostOf(info.Conn); ok {
+				gotConn(host)
+			}
+		},
+		GotFirstResponseByte: func() {
+			t.lock.Lock()
+			t.firstByte = time.Since(t.start)
+			t.lock.Unlock()
+		},
+	}
+}
+
+// durations 返回各阶段耗时(毫秒)，未经历的阶段为0
+func (t *httpConnTimings) durations() (dns, connect, tlsCost, firstByte int, reused bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return int(t.dns.Milliseconds()), int(t.connect.Milliseconds()), int(t.tls.Milliseconds()),
+		int(t.firstByte.Milliseconds()), t.reused
+}
+
+// HttpPoolStat 某个目标地址的连接统计
+type HttpPoolStat struct {
+	Host   string `json:"host"`   // 拨号地址 host:port，使用代理时为代理地址
+	Open   int64  `json:"open"`   // 当前打开的连接数
+	Active int64  `json:"active"` // 正在处理请求的连接数，HTTP/2 下一个连接可同时处理多个请求
+	Idle   int64  `json:"idle"`   // 空闲连接数
+	Dials  int64  `json:"dials"`  // 累计新建连接数
+	Reuses int64  `json:"reuses"` // 累计复用连接次数
+}
+
+type hostPoolStat struct {
+	open   int64
+	active int64
+	dials  int64
+	reuses int64
+}
+
+// httpPoolStats 通过包装 DialContext 及 httptrace 统计连接池
+type httpPoolStats struct {
+	lock  sync.RWMutex
+	hosts map[string]*hostPoolStat
+}
+
+func newHttpPoolStats() *httpPoolStats {
+	return &httpPoolStats{hosts: make(map[string]*hostPoolStat)}
+}
+
+func (p *httpPoolStats) host(host string) *hostPoolStat {
+	p.lock.RLock()
+	stat, ok := p.hosts[host]
+	p.lock.RUnlock()
+	if ok {
+		return stat
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if stat, ok = p.hosts[host]; !ok {
+		stat = &hostPoolStat{}
+		p.hosts[host] = stat
+	}
+	return stat
+}
+
+type dialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (p *httpPoolStats) wrapDial(dial dialContextFunc) dialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		stat := p.host(addr)
+		atomic.AddInt64(&stat.open, 1)
+		atomic.AddInt64(&stat.dials, 1)
+		return &poolConn{Conn: conn, host: addr, stat: stat}, nil
+	}
+}
+
+// hostOf 取出连接对应的拨号地址
+func (p *httpPoolStats) hostOf(conn net.Conn) (string, bool) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if pc, ok := conn.(*poolConn); ok {
+		return pc.host, true
+	}
+	return "", false
+}
+
+// poolConn 关闭时减少打开连接数
+type poolConn struct {
+	net.Conn
+	host string
+	stat *hostPoolStat
+	once sync.Once
+}
+
+func (c *poolConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(&c.stat.open, -1)
+	})
+	return c.Conn.Close()
+}
+
+// PoolStats 各目标地址的连接统计，按地址排序
+func (c *HttpClient) PoolStats() []HttpPoolStat {
+	if c.pool == nil {
+		return nil
+	}
+	c.pool.lock.RLock()
+	defer c.pool.lock.RUnlock()
+
+	stats := make([]HttpPoolStat, 0, len(c.pool.hosts))
+	for host, stat := range c.pool.hosts {
+		item := HttpPoolStat{
+			Host:   host,
+			Open:   atomic.LoadInt64(&stat.open),
+			Active: atomic.LoadInt64(&stat.active),
+			Dials:  atomic.LoadInt64(&stat.dials),
+			Reuses: atomic.LoadInt64(&stat.reuses),
+		}
+		if item.Idle = item.Open - item.Active; item.Idle < 0 {
+			item.Idle = 0
+		}
+		stats = append(stats, item)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Host < stats[j].Host
+	})
+	return stats
+}
+
+// connTraceInterceptor 记录连接各阶段耗时供日志和链路追踪使用，并统计活跃连接
+func (c *HttpClient) connTraceInterceptor(next HttpRoundTripFunc) HttpRoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		state := getHttpCallState(req.Context())
+		if state == nil || c.pool == nil {
+			return next(req)
+		}
+
+		timings := &httpConnTimings{start: time.Now()}
+		state.timings = timings
+		var activeStat *hostPoolStat
+		trace := timings.clientTrace(c.pool, func(host string) {
+			// HTTP/2 下 GotConn 每个请求触发一次，重定向或复用连接失效重试时会再次触发，先释放上一个连接的计数
+			if activeStat != nil {
+				atomic.AddInt64(&activeStat.active, -1)
+			}
+			activeStat = c.pool.host(host)
+			atomic.AddInt64(&activeStat.active, 1)
+			if timings.reused {
+				atomic.AddInt64(&activeStat.reuses, 1)
+			}
+		})
+		traceReq := req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+		resp, err := next(traceReq)
+		release := func() {
+			if activeStat != nil {
+				atomic.AddInt64(&activeStat.active, -1)
+			}
+		}
+		if err != nil || resp == nil {
+			release()
+			return resp, err
+		}
+		resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+		return resp, nil
+	}
+}
+
+// applyHttpVersion 统计连接池并按 HttpVersion 启用 HTTP/2
+func (c *HttpClient) applyHttpVersion(version string) {
+	transport, ok := c.Client.Transport.(*http.Transport)
+	if !ok {
+		return
+	}
+	c.pool = newHttpPoolStats()
+	transport.DialContext = c.pool.wrapDial(transport.DialContext)
+
+	switch version {
+	case HttpVersion2:
+		transport.ForceAttemptHTTP2 = true
+	case HttpVersionH2C:
+		dial := transport.DialContext
+		c.Client.Transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+
+	"github.com/ctl5563096/base/contract"
+)
+
+// HttpErrorDecoderInterface 从响应中解析业务错误，无业务错误时返回nil
+type HttpErrorDecoderInterface interface {
+	Decode(resp *http.Response, body []byte) error
+}
+
+// EnvelopeErrorDecoder 解析 {"code":..,"msg":..} 形式的响应
+type EnvelopeErrorDecoder struct {
+	CodeField      string // 业务码字段，默认 code
+	MsgField       string // 错误信息字段，默认 msg
+	SuccessCodes   []int  // 表示成功的业务码，默认 0
+	CheckOnSuccess bool   // 2xx 响应是否也检查业务码
+}
+
+// Decode 非2xx响应总是尝试解析，2xx响应仅在 CheckOnSuccess 时检查，业务码为成功码时返回nil
+func (d *EnvelopeErrorDecoder) Decode(resp *http.Response, body []byte) error {
+	success := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if success && !d.CheckOnSuccess {
+		return nil
+	}
+
+	codeField, msgField := d.CodeField, d.MsgField
+	if codeField == "" {
+		codeField = "code"
+	}
+	if msgField == "" {
+		msgField = "msg"
+	}
+
+	var envelope map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&envelope); err != nil {
+		return nil
+	}
+	code, ok := envelopeCode(envelope[codeField])
+	if !ok {
+		return nil
+	}
+
+	successCodes := d.SuccessCodes
+	if len(successCodes) == 0 {
+		successCodes = []int{0}
+	}
+	// 业务码表示成功时不视为业务错误，与状态码无关，状态码是否符合预期由 ExpectStatus 判断
+	for _, successCode := range successCodes {
+		if code == successCode {
+			return nil
+		}
+	}
+
+	msg, _ := envelope[msgField].(string)
+	return &contract.BusinessError{
+		HttpStatus: resp.StatusCode,
+		Code:       code,
+		Msg:        msg,
+		Body:       body,
+	}
+}
+
+// newHttpErrorDecoder 未配置时默认解析非2xx响应中的 {"code":..,"msg":..}
+func newHttpErrorDecoder(decoder HttpErrorDecoderInterface) HttpErrorDecoderInterface {
+	if decoder == nil {
+		return &EnvelopeErrorDecoder{}
+	}
+	return decoder
+}
+
+func envelopeCode(val interface{}) (int, bool) {
+	switch v := val.(type) {
+	case json.Number:
+		code, err := v.Int64()
+		return int(code), err == nil
+	case string:
+		code, err := strconv.Atoi(v)
+		return code, err == nil
+	}
+	return 0, false
+}
+
+// classifyHttpError 按超时、DNS、拒绝连接等对传输错误分类
+func classifyHttpError(err error) error {
+	var transportErr *contract.HttpTransportError
+	if err == nil || errors.As(err, &transportErr) {
+		return err
+	}
+
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &contract.HttpTransportError{Kind: contract.ErrHttpTimeout, Err: err}
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTimeout {
+			return &contract.HttpTransportError{Kind: contract.ErrHttpTimeout, Err: err}
+		}
+		return &contract.HttpTransportError{Kind: contract.ErrHttpDNS, Err: err}
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return &contract.HttpTransportError{Kind: contract.ErrHttpConnRefused, Err: err}
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return &contract.HttpTransportError{Kind: contract.ErrHttpTimeout, Err: err}
+	case errors.As(err, &opErr), isConnError(err):
+		return &contract.HttpTransportError{Kind: contract.ErrHttpConnection, Err: err}
+	}
+	return err
+}
+
+// ErrorDecoder 本次请求使用的业务错误解析器，覆盖 HttpClientConfig.ErrorDecoder
+func (r *HttpRequest) ErrorDecoder(decoder HttpErrorDecoderInterface) *HttpRequest {
+	r.errorDecoder = decoder
+	return r
+}
+
+func (r *HttpRequest) decodeError(resp *http.Response, body []byte) error {
+	decoder := r.errorDecoder
+	if decoder == nil {
+		decoder = r.client.errorDecoder
+	}
+	if decoder == nil {
+		return nil
+	}
+	return decoder.Decode(resp, body)
+}
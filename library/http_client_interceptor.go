@@ -0,0 +1,343 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ctl5563096/base/contract"
+)
+
+// HttpRoundTripFunc 执行一次http请求
+type HttpRoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// HttpInterceptor 请求拦截器，Wrap 包装下一个处理函数，Name 用于排序、替换和禁用
+type HttpInterceptor struct {
+	Name string
+	Wrap func(next HttpRoundTripFunc) HttpRoundTripFunc
+}
+
+// 内置拦截器名称
+const (
+	HttpInterceptorXeHeader       = "xe_header"       // 透传灰度、链路请求头
+	HttpInterceptorLog            = "log"             // 请求日志
+	HttpInterceptorCache          = "cache"           // 响应缓存
+	HttpInterceptorRetry          = "retry"           // 重试
+	HttpInterceptorRateLimit      = "rate_limit"      // 出站限流及并发限制
+	HttpInterceptorAuth           = "auth"            // 鉴权、签名
+	HttpInterceptorLoadBalance    = "load_balance"    // 服务发现及负载均衡
+	HttpInterceptorCircuitBreaker = "circuit_breaker" // 熔断
+	HttpInterceptorMetrics        = "metrics"         // prometheus指标
+	HttpInterceptorTracing        = "tracing"         // skyWalking链路追踪
+	HttpInterceptorConnTrace      = "conn_trace"      // 连接耗时及连接池统计
+)
+
+// DefaultHttpInterceptors 默认拦截器链，按顺序由外到内执行
+// 重试之后的拦截器在每次尝试时都会执行
+func (c *HttpClient) DefaultHttpInterceptors() []HttpInterceptor {
+	return []HttpInterceptor{
+		{Name: HttpInterceptorXeHeader, Wrap: xeHeaderInterceptor},
+		{Name: HttpInterceptorLog, Wrap: c.logInterceptor},
+		{Name: HttpInterceptorCache, Wrap: c.cacheInterceptor},
+		{Name: HttpInterceptorRetry, Wrap: c.retryInterceptor},
+		{Name: HttpInterceptorRateLimit, Wrap: c.rateLimitInterceptor},
+		{Name: HttpInterceptorAuth, Wrap: c.authInterceptor},
+		{Name: HttpInterceptorLoadBalance, Wrap: c.loadBalanceInterceptor},
+		{Name: HttpInterceptorCircuitBreaker, Wrap: c.circuitBreakerInterceptor},
+		{Name: HttpInterceptorMetrics, Wrap: c.metricsInterceptor},
+		{Name: HttpInterceptorTracing, Wrap: tracingInterceptor},
+		{Name: HttpInterceptorConnTrace, Wrap: c.connTraceInterceptor},
+	}
+}
+
+// Interceptors 当前生效的拦截器链
+func (c *HttpClient) Interceptors() []HttpInterceptor {
+	c.interceptorLock.RLock()
+	defer c.interceptorLock.RUnlock()
+	return c.currentInterceptors()
+}
+
+// SetInterceptors 替换整个拦截器链，可用于重新排序或禁用内置拦截器
+func (c *HttpClient) SetInterceptors(interceptors ...HttpInterceptor) {
+	c.interceptorLock.Lock()
+	defer c.interceptorLock.Unlock()
+	c.interceptors = append([]HttpInterceptor{}, interceptors...)
+	c.chain = nil
+}
+
+// Use 在链尾(最内层，每次尝试都会执行)追加拦截器
+func (c *HttpClient) Use(interceptors ...HttpInterceptor) {
+	c.interceptorLock.Lock()
+	defer c.interceptorLock.Unlock()
+	c.interceptors = append(c.currentInterceptors(), interceptors...)
+	c.chain = nil
+}
+
+// UseBefore 在指定名称的拦截器之前(外层)插入，找不到时返回错误
+func (c *HttpClient) UseBefore(name string, interceptors ...HttpInterceptor) error {
+	return c.insertInterceptors(name, 0, interceptors)
+}
+
+// UseAfter 在指定名称的拦截器之后(内层)插入，找不到时返回错误
+func (c *HttpClient) UseAfter(name string, interceptors ...HttpInterceptor) error {
+	return c.insertInterceptors(name, 1, interceptors)
+}
+
+// RemoveInterceptor 按名称禁用拦截器
+func (c *HttpClient) RemoveInterceptor(name string) {
+	c.interceptorLock.Lock()
+	defer c.interceptorLock.Unlock()
+	current := c.currentInterceptors()
+	interceptors := make([]HttpInterceptor, 0, len(current))
+	for _, interceptor := range current {
+		if interceptor.Name != name {
+			interceptors = append(interceptors, interceptor)
+		}
+	}
+	c.interceptors = interceptors
+	c.chain = nil
+}
+
+func (c *HttpClient) insertInterceptors(name string, offset int, inserts []HttpInterceptor) error {
+	c.interceptorLock.Lock()
+	defer c.interceptorLock.Unlock()
+	current := c.currentInterceptors()
+	for i, interceptor := range current {
+		if interceptor.Name != name {
+			continue
+		}
+		pos := i + offset
+		interceptors := make([]HttpInterceptor, 0, len(current)+len(inserts))
+		interceptors = append(interceptors, current[:pos]...)
+		interceptors = append(interceptors, inserts...)
+		interceptors = append(interceptors, current[pos:]...)
+		c.interceptors = interceptors
+		c.chain = nil
+		return nil
+	}
+	return fmt.Errorf("http interceptor %s not found", name)
+}
+
+// currentInterceptors 调用方需持有 interceptorLock
+func (c *HttpClient) currentInterceptors() []HttpInterceptor {
+	if c.interceptors == nil {
+		return c.DefaultHttpInterceptors()
+	}
+	return append([]HttpInterceptor{}, c.interceptors...)
+}
+
+// roundTripChain 返回组装好的拦截器链，链尾为 http.Client.Do
+func (c *HttpClient) roundTripChain() HttpRoundTripFunc {
+	c.interceptorLock.RLock()
+	chain := c.chain
+	c.interceptorLock.RUnlock()
+	if chain != nil {
+		return chain
+	}
+
+	c.interceptorLock.Lock()
+	defer c.interceptorLock.Unlock()
+	if c.chain != nil {
+		return c.chain
+	}
+	interceptors := c.currentInterceptors()
+	chain = func(req *http.Request) (*http.Response, error) {
+		if state := getHttpCallState(req.Context()); state != nil {
+			state.setSentHeader(req.Header)
+			if state.stream && c.Client.Timeout > 0 {
+				return c.doStream(req)
+			}
+		}
+		return c.Client.Do(req)
+	}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		if interceptors[i].Wrap != nil {
+			chain = interceptors[i].Wrap(chain)
+		}
+	}
+	c.chain = chain
+	return chain
+}
+
+// doStream http.Client.Timeout 包含读取响应体的时间，流式读取时只用于限制等待响应头，响应体由 ctx 与空闲超时控制
+func (c *HttpClient) doStream(req *http.Request) (*http.Response, error) {
+	timeout := c.Client.Timeout
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(timeout, cancel)
+
+	client := *c.Client
+	client.Timeout = 0
+	resp, err := client.Do(req.WithContext(ctx))
+	// Stop 返回false表示等待响应头超时，请求已被取消
+	if !timer.Stop() {
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("stream response header timeout after %s: %w", timeout, context.DeadlineExceeded)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody 关闭响应体时释放请求的 context
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+type httpCallStateKey struct{}
+
+// httpCallState 单次调用在拦截器之间共享的状态
+type httpCallState struct {
+	logger   contract.XiaoeRequestLoggerInterface
+	params   string // 记录到日志的请求参数
+	attempt  int    // 当前第几次尝试
+	cacheKey string // 自定义缓存key
+	noCache  bool   // 不读写缓存
+	auth     HttpAuthProviderInterface
+	timings  *httpConnTimings // 最近一次尝试的连接耗时
+	stream   bool             // 流式读取，不使用 http.Client.Timeout
+	caller   context.Context  // 调用方传入的 ctx，不包含 HttpRequest.Timeout
+
+	lock        sync.Mutex
+	sentHeader  http.Header // 最近一次尝试实际发出的请求头，包含内层拦截器添加的链路、鉴权请求头
+	authHeaders []string    // 鉴权方式设置或修改的请求头，记录日志时隐藏
+	result      error       // 调用方处理响应后的最终错误，如解码失败、业务错误、响应体超限
+}
+
+// isCallerCancelled 调用方取消或到达调用方自己的截止时间，HttpRequest.Timeout 设置的超时不算
+func isCallerCancelled(ctx context.Context) bool {
+	if state := getHttpCallState(ctx); state != nil && state.caller != nil {
+		return state.caller.Err() != nil
+	}
+	return ctx.Err() != nil
+}
+
+func (s *httpCallState) setSentHeader(header http.Header) {
+	s.lock.Lock()
+	s.sentHeader = header.Clone()
+	s.lock.Unlock()
+}
+
+func (s *httpCallState) setAuthHeaders(names []string) {
+	s.lock.Lock()
+	s.authHeaders = names
+	s.lock.Unlock()
+}
+
+// getSentHeader 返回实际发出的请求头及其中的鉴权请求头名
+func (s *httpCallState) getSentHeader() (http.Header, []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sentHeader, s.authHeaders
+}
+
+// setResult 需在关闭响应体之前调用，才能记录到请求日志中
+func (s *httpCallState) setResult(err error) {
+	s.lock.Lock()
+	s.result = err
+	s.lock.Unlock()
+}
+
+func (s *httpCallState) getResult() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.result
+}
+
+func withHttpCallState(ctx context.Context, state *httpCallState) context.Context {
+	return context.WithValue(ctx, httpCallStateKey{}, state)
+}
+
+func getHttpCallState(ctx context.Context) *httpCallState {
+	state, _ := ctx.Value(httpCallStateKey{}).(*httpCallState)
+	return state
+}
+
+const defaultMaxLogResponseBytes = 64 * 1024
+
+// logInterceptor 通过调用方传入的 logger 记录请求日志，响应体在关闭时记录，错误信息优先使用调用方处理响应后的结果
+// 响应体超过 MaxLogResponseBytes 时只记录前面部分
+func (c *HttpClient) logInterceptor(next HttpRoundTripFunc) HttpRoundTripFunc {
+	maxLogBytes := c.maxLogResponseBytes
+	if maxLogBytes <= 0 {
+		maxLogBytes = defaultMaxLogResponseBytes
+	}
+
+	return func(req *http.Request) (resp *http.Response, err error) {
+		state := getHttpCallState(req.Context())
+		if state == nil || state.logger == nil {
+			return next(req)
+		}
+
+		beginTime := time.Now()
+		resp, err = next(req)
+		if err != nil || resp == nil {
+			recordLog(req, &resp, &state.params, nil, &err, &state.attempt, beginTime, state.logger)
+			return
+		}
+
+		logResp := resp
+		resp.Body = &loggingBody{
+			ReadCloser: resp.Body,
+			limit:      maxLogBytes,
+			onClose: func(body []byte) {
+				logErr := state.getResult()
+				if logErr == nil && (logResp.StatusCode < 200 || logResp.StatusCode >= 300) {
+					logErr = fmt.Errorf("response error, code %d", logResp.StatusCode)
+				}
+				recordLog(req, &logResp, &state.params, &body, &logErr, &state.attempt, beginTime, state.logger)
+			},
+		}
+		return
+	}
+}
+
+// loggingBody 读取响应体的同时保留最多 limit 字节的副本，Close 时回调记录日志
+type loggingBody struct {
+	io.ReadCloser
+	buf     bytes.Buffer
+	limit   int
+	total   int64
+	once    sync.Once
+	onClose func(body []byte)
+}
+
+func (b *loggingBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	b.total += int64(n)
+	if remain := b.limit - b.buf.Len(); remain > 0 {
+		if remain > n {
+			remain = n
+		}
+		b.buf.Write(p[:remain])
+	}
+	return
+}
+
+func (b *loggingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		body := b.buf.Bytes()
+		if b.total > int64(b.buf.Len()) {
+			body = append(body, fmt.Sprintf("...(truncated, read %d bytes)", b.total)...)
+		}
+		b.onClose(body)
+	})
+	return err
+}
@@ -0,0 +1,286 @@
+package library
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctl5563096/base/contract"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const httpRateLimitKeyPrefix = "http_rate_limit:"
+
+// HttpRateLimiterInterface 令牌桶限流器
+type HttpRateLimiterInterface interface {
+	// Take 尝试获取一个令牌，获取失败时不消耗令牌并返回预计需要等待的时长
+	Take(ctx context.Context, key string, qps float64, burst int) (wait time.Duration, err error)
+}
+
+// LocalRateLimiter 进程内令牌桶
+type LocalRateLimiter struct {
+	lock    sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewLocalRateLimiter() *LocalRateLimiter {
+	return &LocalRateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+func (l *LocalRateLimiter) Take(ctx context.Context, key string, qps float64, burst int) (time.Duration, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(burst), last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.last).Seconds()*qps)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0, nil
+	}
+	return time.Duration((1 - bucket.tokens) / qps * float64(time.Second)), nil
+}
+
+// redisTokenBucketScript 使用 redis 服务端时间，避免各副本时钟不一致
+var redisTokenBucketScript = redis.NewScript(`
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return wait
+`)
+
+// RedisRateLimiter 基于 RedisClient 的令牌桶，多副本共享同一配额
+type RedisRateLimiter struct {
+	client *RedisClient
+}
+
+func NewRedisRateLimiter(client *RedisClient) *RedisRateLimiter {
+	return &RedisRateLimiter{client: client}
+}
+
+func (l *RedisRateLimiter) Take(ctx context.Context, key string, qps float64, burst int) (time.Duration, error) {
+	waitMillisecond, err := redisTokenBucketScript.Run(ctx, l.client, []string{key}, qps, burst).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(waitMillisecond) * time.Millisecond, nil
+}
+
+// httpRateLimiter 按规则对出站请求限流及限制并发
+type httpRateLimiter struct {
+	rules    []HttpRateLimitRule
+	failFast bool
+	limiter  HttpRateLimiterInterface
+	logger   *zap.Logger
+
+	lock      sync.Mutex
+	inFlights map[string]*inFlightSlots
+}
+
+// inFlightSlots 单个key的并发名额，refs 为占用及等待中的请求数，归零时从 inFlights 中删除
+type inFlightSlots struct {
+	slots chan struct{}
+	refs  int
+}
+
+func newHttpRateLimiter(conf *HttpRateLimitConfig) *httpRateLimiter {
+	if conf == nil || len(conf.Rules) == 0 {
+		return nil
+	}
+
+	l := &httpRateLimiter{
+		rules:     conf.Rules,
+		failFast:  conf.FailFast,
+		limiter:   conf.Limiter,
+		logger:    conf.Logger,
+		inFlights: make(map[string]*inFlightSlots),
+	}
+	if l.limiter == nil {
+		l.limiter = NewLocalRateLimiter()
+	}
+	return l
+}
+
+// match 返回第一条匹配的规则及其限流key
+func (l *httpRateLimiter) match(req *http.Request) (*HttpRateLimitRule, string) {
+	for i := range l.rules {
+		rule := &l.rules[i]
+		if rule.Host != "" && !strings.EqualFold(rule.Host, req.URL.Host) {
+			continue
+		}
+		if !strings.HasPrefix(req.URL.Path, rule.PathPrefix) {
+			continue
+		}
+		if rule.Name != "" {
+			return rule, httpRateLimitKeyPrefix + rule.Name
+		}
+		return rule, httpRateLimitKeyPrefix + req.URL.Host + rule.PathPrefix
+	}
+	return nil, ""
+}
+
+// wait 获取令牌，FailFast 或等待时间超过 context 截止时间时返回 *contract.RateLimitedError
+// 限流器本身出错(如redis不可用)时放行
+func (l *httpRateLimiter) wait(ctx context.Context, rule *HttpRateLimitRule, key string) error {
+	if rule.QPS <= 0 {
+		return nil
+	}
+	burst := rule.Burst
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rule.QPS)))
+	}
+
+	for {
+		wait, err := l.limiter.Take(ctx, key, rule.QPS, burst)
+		if err != nil {
+			if l.logger != nil {
+				l.logger.Warn("http rate limiter error, request allowed",
+					zap.String("key", key),
+					zap.Error(err))
+			}
+			return nil
+		}
+		if wait <= 0 {
+			return nil
+		}
+		if l.failFast {
+			return &contract.RateLimitedError{Key: key, RetryAfter: wait}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return &contract.RateLimitedError{Key: key, RetryAfter: wait}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// acquire 占用一个并发名额，返回释放函数
+func (l *httpRateLimiter) acquire(ctx context.Context, rule *HttpRateLimitRule, key string) (func(), error) {
+	if rule.MaxInFlight <= 0 {
+		return func() {}, nil
+	}
+
+	l.lock.Lock()
+	inFlight, ok := l.inFlights[key]
+	if !ok {
+		inFlight = &inFlightSlots{slots: make(chan struct{}, rule.MaxInFlight)}
+		l.inFlights[key] = inFlight
+	}
+	inFlight.refs++
+	l.lock.Unlock()
+
+	release := func() {
+		<-inFlight.slots
+		l.unref(key, inFlight)
+	}
+	if l.failFast {
+		select {
+		case inFlight.slots <- struct{}{}:
+			return release, nil
+		default:
+			l.unref(key, inFlight)
+			return nil, &contract.RateLimitedError{Key: key}
+		}
+	}
+	select {
+	case inFlight.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		l.unref(key, inFlight)
+		return nil, ctx.Err()
+	}
+}
+
+func (l *httpRateLimiter) unref(key string, inFlight *inFlightSlots) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	inFlight.refs--
+	if inFlight.refs == 0 {
+		delete(l.inFlights, key)
+	}
+}
+
+// rateLimitInterceptor 按 host/路径前缀限制 QPS 和并发，并发名额在响应体关闭时释放
+func (c *HttpClient) rateLimitInterceptor(next HttpRoundTripFunc) HttpRoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if c.rateLimiter == nil {
+			return next(req)
+		}
+		rule, key := c.rateLimiter.match(req)
+		if rule == nil {
+			return next(req)
+		}
+
+		release, err := c.rateLimiter.acquire(req.Context(), rule, key)
+		if err != nil {
+			return nil, err
+		}
+		if err = c.rateLimiter.wait(req.Context(), rule, key); err != nil {
+			release()
+			return nil, err
+		}
+
+		resp, err := next(req)
+		if err != nil || resp == nil {
+			release()
+			return resp, err
+		}
+		resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+		return resp, nil
+	}
+}
+
+// releaseBody 关闭时执行一次 release
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
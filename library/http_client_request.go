@@ -0,0 +1,387 @@
+package library
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ctl5563096/base/contract"
+)
+
+// HttpRequest 链式构建请求，所有 HttpClient 的请求方法都基于它实现
+//
+//	var user User
+//	_, err := client.NewRequest(ctx).
+//		Method(http.MethodPut).
+//		URL("http://user-center/users/{id}").
+//		PathParam("id", "42").
+//		JSONBody(params).
+//		Decode(&user).
+//		Logger(logger).
+//		Do()
+type HttpRequest struct {
+	client       *HttpClient
+	ctx          context.Context
+	method       string
+	rawUrl       string
+	pathParams   map[string]string
+	query        url.Values
+	header       http.Header
+	body         io.Reader
+	getBody      func() (io.ReadCloser, error)
+	logParams    string
+	timeout      time.Duration
+	expectStatus map[int]struct{}
+	decodeTarget interface{}
+	maxBytes     int64
+	cacheKey     string
+	noCache      bool
+	errorDecoder HttpErrorDecoderInterface
+	auth         HttpAuthProviderInterface
+	logger       contract.XiaoeRequestLoggerInterface
+	err          error
+	stream       bool           // 流式读取响应体，不使用 http.Client.Timeout
+	state        *httpCallState // 最近一次 send 的调用状态
+}
+
+// MultipartFile multipart 上传的文件
+type MultipartFile struct {
+	FieldName string    // 表单字段名
+	FileName  string    // 文件名
+	Reader    io.Reader // 文件内容
+}
+
+func (c *HttpClient) NewRequest(ctx context.Context) *HttpRequest {
+	return &HttpRequest{
+		client:     c,
+		ctx:        ctx,
+		method:     http.MethodGet,
+		pathParams: map[string]string{},
+		query:      url.Values{},
+		header:     http.Header{},
+	}
+}
+
+func (r *HttpRequest) Method(method string) *HttpRequest {
+	r.method = strings.ToUpper(method)
+	return r
+}
+
+// URL 请求地址，支持 {name} 形式的路径参数
+func (r *HttpRequest) URL(rawUrl string) *HttpRequest {
+	r.rawUrl = rawUrl
+	return r
+}
+
+func (r *HttpRequest) PathParam(key, value string) *HttpRequest {
+	r.pathParams[key] = value
+	return r
+}
+
+func (r *HttpRequest) PathParams(params map[string]string) *HttpRequest {
+	for key, value := range params {
+		r.pathParams[key] = value
+	}
+	return r
+}
+
+func (r *HttpRequest) Query(key, value string) *HttpRequest {
+	r.query.Add(key, value)
+	return r
+}
+
+func (r *HttpRequest) QueryMap(query map[string]string) *HttpRequest {
+	for key, value := range query {
+		r.query.Add(key, value)
+	}
+	return r
+}
+
+func (r *HttpRequest) QueryValues(query url.Values) *HttpRequest {
+	for key, values := range query {
+		for _, value := range values {
+			r.query.Add(key, value)
+		}
+	}
+	return r
+}
+
+func (r *HttpRequest) Header(key, value string) *HttpRequest {
+	r.header.Add(key, value)
+	return r
+}
+
+func (r *HttpRequest) Headers(header map[string]string) *HttpRequest {
+	for key, value := range header {
+		r.header.Add(key, value)
+	}
+	return r
+}
+
+// JSONBody 序列化为json请求体，并设置 Content-Type/Accept 为 application/json
+func (r *HttpRequest) JSONBody(params interface{}) *HttpRequest {
+	r.header.Set("Content-Type", "application/json")
+	r.header.Set("Accept", "application/json")
+	if params == nil {
+		return r
+	}
+
+	paramsBytes, err := json.Marshal(params)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	return r.bytesBody(paramsBytes, string(paramsBytes))
+}
+
+// FormBody application/x-www-form-urlencoded 请求体
+func (r *HttpRequest) FormBody(form url.Values) *HttpRequest {
+	encoded := form.Encode()
+	r.header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r.bytesBody([]byte(encoded), encoded)
+}
+
+// MultipartBody multipart/form-data 请求体，文件内容会被一次性读入内存以支持重试
+func (r *HttpRequest) MultipartBody(fields map[string]string, files ...MultipartFile) *HttpRequest {
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+	var logParams []string
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			r.err = err
+			return r
+		}
+		logParams = append(logParams, key+"="+value)
+	}
+	for _, file := range files {
+		part, err := writer.CreateFormFile(file.FieldName, file.FileName)
+		if err != nil {
+			r.err = err
+			return r
+		}
+		if _, err = io.Copy(part, file.Reader); err != nil {
+			r.err = fmt.Errorf("read multipart file %s: %w", file.FileName, err)
+			return r
+		}
+		logParams = append(logParams, file.FieldName+"=@"+file.FileName)
+	}
+	if err := writer.Close(); err != nil {
+		r.err = err
+		return r
+	}
+
+	r.header.Set("Content-Type", writer.FormDataContentType())
+	return r.bytesBody(buf.Bytes(), strings.Join(logParams, "&"))
+}
+
+// RawBody 原始请求体
+func (r *HttpRequest) RawBody(contentType string, body []byte) *HttpRequest {
+	if contentType != "" {
+		r.header.Set("Content-Type", contentType)
+	}
+	return r.bytesBody(body, string(body))
+}
+
+// StreamBody 流式请求体，不会记录到日志，且无法重试
+func (r *HttpRequest) StreamBody(contentType string, body io.Reader) *HttpRequest {
+	if contentType != "" {
+		r.header.Set("Content-Type", contentType)
+	}
+	r.body = body
+	r.getBody = nil
+	r.logParams = ""
+	return r
+}
+
+func (r *HttpRequest) bytesBody(body []byte, logParams string) *HttpRequest {
+	r.body = bytes.NewReader(body)
+	r.getBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	r.logParams = logParams
+	return r
+}
+
+// Timeout 单次调用的超时时间(包含所有重试)，与 HttpClientConfig.RequestTimeoutSecond 取较小者生效
+// 流式读取时只使用该超时，RequestTimeoutSecond 作为等待响应头及读取的空闲超时
+func (r *HttpRequest) Timeout(timeout time.Duration) *HttpRequest {
+	r.timeout = timeout
+	return r
+}
+
+// ExpectStatus 视为成功的状态码，未设置时 2xx 均视为成功
+func (r *HttpRequest) ExpectStatus(codes ...int) *HttpRequest {
+	if r.expectStatus == nil {
+		r.expectStatus = make(map[int]struct{}, len(codes))
+	}
+	for _, code := range codes {
+		r.expectStatus[code] = struct{}{}
+	}
+	return r
+}
+
+// Decode 成功时将响应体按json解析到 target
+func (r *HttpRequest) Decode(target interface{}) *HttpRequest {
+	r.decodeTarget = target
+	return r
+}
+
+// MaxResponseBytes 响应体最大字节数，覆盖 HttpClientConfig.MaxResponseBytes，流式读取时同样生效
+func (r *HttpRequest) MaxResponseBytes(limit int64) *HttpRequest {
+	r.maxBytes = limit
+	return r
+}
+
+func (r *HttpRequest) Logger(logger contract.XiaoeRequestLoggerInterface) *HttpRequest {
+	r.logger = logger
+	return r
+}
+
+func (r *HttpRequest) build(ctx context.Context) (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.rawUrl == "" {
+		return nil, errors.New("http request url is empty")
+	}
+
+	rawUrl := r.rawUrl
+	for key, value := range r.pathParams {
+		rawUrl = strings.ReplaceAll(rawUrl, "{"+key+"}", url.PathEscape(value))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.method, rawUrl, r.body)
+	if err != nil {
+		return nil, err
+	}
+	if r.getBody != nil {
+		req.GetBody = r.getBody
+	}
+
+	if len(r.query) > 0 {
+		q := req.URL.Query()
+		for key, values := range r.query {
+			for _, value := range values {
+				q.Add(key, value)
+			}
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+
+	for key, values := range r.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return req, nil
+}
+
+func (r *HttpRequest) isExpectStatus(code int) bool {
+	if len(r.expectStatus) == 0 {
+		//2开头的状态码都是OK
+		return code >= 200 && code < 300
+	}
+	_, ok := r.expectStatus[code]
+	return ok
+}
+
+// send 发送请求，状态码不符合预期时返回 *contract.HttpResponseError，成功时由调用方关闭响应体
+func (r *HttpRequest) send(ctx context.Context) (*http.Response, error) {
+	r.state = &httpCallState{
+		logger:   r.logger,
+		params:   r.logParams,
+		cacheKey: r.cacheKey,
+		noCache:  r.noCache,
+		auth:     r.auth,
+		stream:   r.stream,
+		caller:   r.ctx,
+	}
+	ctx = withHttpCallState(ctx, r.state)
+	req, err := r.build(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	clientResp, err := r.client.Do(req)
+
+	if err != nil {
+		err = fmt.Errorf("response is nil: %w", classifyHttpError(err))
+		return nil, err
+	}
+
+	if clientResp == nil {
+		err = fmt.Errorf("response is nil: %w", err)
+		return nil, err
+	}
+
+	if !r.isExpectStatus(clientResp.StatusCode) {
+		resBody, _ := getBytesFromHttpResponse(clientResp, r.responseLimit())
+		err = &contract.HttpResponseError{
+			Code:         clientResp.StatusCode,
+			Msg:          fmt.Sprintf("response error, code %d", clientResp.StatusCode),
+			Err:          r.decodeError(clientResp, resBody),
+			ResponseBody: resBody,
+		}
+		r.state.setResult(err)
+		_ = clientResp.Body.Close()
+		return nil, err
+	}
+	return clientResp, nil
+}
+
+// responseLimit 完整读取响应体时的字节上限
+func (r *HttpRequest) responseLimit() int64 {
+	if r.maxBytes > 0 {
+		return r.maxBytes
+	}
+	return r.client.maxResponseBytes
+}
+
+func (r *HttpRequest) withTimeout() (context.Context, context.CancelFunc) {
+	if r.timeout > 0 {
+		return context.WithTimeout(r.ctx, r.timeout)
+	}
+	return context.WithCancel(r.ctx)
+}
+
+// Do 发送请求并读取完整响应体，状态码不符合预期时返回 *contract.HttpResponseError
+// 2xx 响应被 ErrorDecoder 识别为业务错误时返回 *contract.BusinessError
+// 响应体超过 MaxResponseBytes 时返回 *contract.ResponseTooLargeError
+func (r *HttpRequest) Do() (response []byte, err error) {
+	ctx, cancel := r.withTimeout()
+	defer cancel()
+
+	clientResp, err := r.send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer clientResp.Body.Close()
+	// 在关闭响应体之前执行，使请求日志记录最终的错误
+	defer func() {
+		r.state.setResult(err)
+	}()
+
+	response, err = getBytesFromHttpResponse(clientResp, r.responseLimit())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.decodeError(clientResp, response); err != nil {
+		return response, err
+	}
+
+	if r.decodeTarget != nil {
+		if err = json.Unmarshal(response, r.decodeTarget); err != nil {
+			return response, err
+		}
+	}
+	return response, nil
+}
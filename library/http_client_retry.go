@@ -0,0 +1,242 @@
+package library
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/ctl5563096/base/contract"
+)
+
+const (
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 10 * time.Second
+	defaultRetryMultiplier     = 2
+)
+
+var defaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// httpRetryPolicy 由 HttpRetryConfig 解析得到的重试策略
+type httpRetryPolicy struct {
+	maxAttempts        int
+	initialBackoff     time.Duration
+	maxBackoff         time.Duration
+	multiplier         float64
+	jitter             float64
+	statusCodes        map[int]struct{}
+	retryOnConnError   bool
+	retryNonIdempotent bool
+	respectRetryAfter  bool
+}
+
+func newHttpRetryPolicy(conf *HttpRetryConfig) *httpRetryPolicy {
+	if conf == nil || conf.MaxAttempts <= 1 {
+		return nil
+	}
+
+	policy := &httpRetryPolicy{
+		maxAttempts:        conf.MaxAttempts,
+		initialBackoff:     time.Duration(conf.InitialBackoffMillisecond) * time.Millisecond,
+		maxBackoff:         time.Duration(conf.MaxBackoffMillisecond) * time.Millisecond,
+		multiplier:         conf.Multiplier,
+		jitter:             conf.Jitter,
+		statusCodes:        make(map[int]struct{}),
+		retryOnConnError:   conf.RetryOnConnError,
+		retryNonIdempotent: conf.RetryNonIdempotent,
+		respectRetryAfter:  conf.RespectRetryAfter,
+	}
+	if policy.initialBackoff <= 0 {
+		policy.initialBackoff = defaultRetryInitialBackoff
+	}
+	if policy.maxBackoff <= 0 {
+		policy.maxBackoff = defaultRetryMaxBackoff
+	}
+	if policy.multiplier < 1 {
+		policy.multiplier = defaultRetryMultiplier
+	}
+	if policy.jitter < 0 {
+		policy.jitter = 0
+	}
+	if policy.jitter > 1 {
+		policy.jitter = 1
+	}
+
+	statusCodes := conf.RetryStatusCodes
+	if len(statusCodes) == 0 {
+		statusCodes = defaultRetryStatusCodes
+	}
+	for _, code := range statusCodes {
+		policy.statusCodes[code] = struct{}{}
+	}
+	return policy
+}
+
+// shouldRetry 判断第 attempt 次尝试的结果是否需要再次请求
+func (p *httpRetryPolicy) shouldRetry(req *http.Request, resp *http.Response, err error, attempt int) bool {
+	if p == nil || attempt >= p.maxAttempts {
+		return false
+	}
+
+	// 调用方已取消或超时
+	if req.Context().Err() != nil {
+		return false
+	}
+
+	if !p.retryNonIdempotent && !isIdempotentRequest(req) {
+		return false
+	}
+
+	// body 无法重放
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		return p.retryOnConnError && isConnError(err)
+	}
+
+	if resp == nil {
+		return false
+	}
+	_, ok := p.statusCodes[resp.StatusCode]
+	return ok
+}
+
+// backoff 计算第 attempt 次尝试失败后的等待时间，ok 为false表示 Retry-After 超过 maxBackoff，不再重试
+func (p *httpRetryPolicy) backoff(attempt int, resp *http.Response) (time.Duration, bool) {
+	if p.respectRetryAfter && resp != nil {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return wait, wait <= p.maxBackoff
+		}
+	}
+
+	wait := float64(p.initialBackoff) * math.Pow(p.multiplier, float64(attempt-1))
+	if wait > float64(p.maxBackoff) {
+		wait = float64(p.maxBackoff)
+	}
+	if p.jitter > 0 {
+		wait = wait * (1 - p.jitter*rand.Float64())
+	}
+	return time.Duration(wait), true
+}
+
+// isIdempotentRequest 幂等方法或带有 Idempotency-Key 请求头的请求
+func isIdempotentRequest(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if _, ok := req.Header["Idempotency-Key"]; ok {
+		return true
+	}
+	if _, ok := req.Header["X-Idempotency-Key"]; ok {
+		return true
+	}
+	return false
+}
+
+// isConnError 连接类错误：拒绝连接、连接重置、连接被提前关闭
+func isConnError(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// parseRetryAfter 支持秒数和 HTTP-date 两种格式
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// retryInterceptor 按重试策略执行请求，每次重试前重放请求体
+// 被重试的尝试通过调用方传入的 logger 记录
+func (c *HttpClient) retryInterceptor(next HttpRoundTripFunc) HttpRoundTripFunc {
+	return func(req *http.Request) (resp *http.Response, err error) {
+		state := getHttpCallState(req.Context())
+		if state == nil {
+			state = &httpCallState{}
+		}
+
+		for attempt := 1; ; attempt++ {
+			state.attempt = attempt
+			beginTime := time.Now()
+			resp, err = next(req)
+			if !c.retryPolicy.shouldRetry(req, resp, err, attempt) {
+				return
+			}
+
+			wait, ok := c.retryPolicy.backoff(attempt, resp)
+			if !ok {
+				return
+			}
+			// 等待时间超过调用方的截止时间则不再重试
+			if deadline, ok := req.Context().Deadline(); ok && time.Now().Add(wait).After(deadline) {
+				return
+			}
+
+			recordAttemptLog(req, resp, err, attempt, beginTime, state.logger)
+			if resp != nil {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+			}
+
+			if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+				body, e := req.GetBody()
+				if e != nil {
+					return nil, e
+				}
+				req.Body = body
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-req.Context().Done():
+				timer.Stop()
+				return nil, req.Context().Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// recordAttemptLog 记录被重试的单次尝试
+func recordAttemptLog(req *http.Request, resp *http.Response, err error, attempt int, beginTime time.Time, logger contract.XiaoeRequestLoggerInterface) {
+	var msg string
+	if err != nil {
+		msg = "retry after error: " + err.Error()
+	} else {
+		msg = "retry after response code " + strconv.Itoa(resp.StatusCode)
+	}
+	var retryErr error = errors.New(msg)
+	recordLog(req, &resp, nil, nil, &retryErr, &attempt, beginTime, logger)
+}
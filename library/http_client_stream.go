@@ -0,0 +1,213 @@
+package library
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ctl5563096/base/contract"
+)
+
+// ServerSentEvent text/event-stream 中的一个事件
+type ServerSentEvent struct {
+	Id    string
+	Event string
+	Data  string
+	Retry int // 毫秒，未设置时为0
+}
+
+// Stream 以流的方式处理响应体，handle 返回后响应体自动关闭
+// 整体耗时只受 ctx 与 Timeout 限制，HttpClientConfig.RequestTimeoutSecond 作为等待响应头及读取的空闲超时
+// 读取字节数受 MaxResponseBytes 限制，未设置时使用 HttpClientConfig.MaxResponseBytes
+func (r *HttpRequest) Stream(handle func(body io.Reader) error) error {
+	ctx, cancel := r.withTimeout()
+	defer cancel()
+
+	r.stream = true
+	clientResp, err := r.send(ctx)
+	if err != nil {
+		return err
+	}
+	defer clientResp.Body.Close()
+
+	var body io.Reader = clientResp.Body
+	if idle := r.client.Client.Timeout; idle > 0 {
+		idleBody := newIdleTimeoutReader(body, idle, cancel)
+		defer idleBody.stop()
+		body = idleBody
+	}
+	if limit := r.responseLimit(); limit > 0 {
+		body = newMaxBytesReader(body, limit)
+	}
+	return handle(body)
+}
+
+// Download 将响应体写入文件，先写入同目录临时文件，成功后再重命名
+func (r *HttpRequest) Download(path string) (written int64, err error) {
+	err = r.Stream(func(body io.Reader) error {
+		tmp, e := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".download-*")
+		if e != nil {
+			return e
+		}
+		defer os.Remove(tmp.Name())
+
+		written, e = io.Copy(tmp, body)
+		if e != nil {
+			_ = tmp.Close()
+			return e
+		}
+		if e = tmp.Close(); e != nil {
+			return e
+		}
+		return os.Rename(tmp.Name(), path)
+	})
+	return
+}
+
+// Lines 逐行处理响应体，适用于 NDJSON 等按行分隔的流，空行会被跳过
+func (r *HttpRequest) Lines(handle func(line []byte) error) error {
+	return r.Stream(func(body io.Reader) error {
+		reader := bufio.NewReader(body)
+		for {
+			line, err := reader.ReadBytes('\n')
+			line = bytes.TrimRight(line, "\r\n")
+			if len(line) > 0 {
+				if e := handle(line); e != nil {
+					return e
+				}
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// Events 按 server-sent events 协议逐个处理事件
+func (r *HttpRequest) Events(handle func(event *ServerSentEvent) error) error {
+	r.header.Set("Accept", "text/event-stream")
+	return r.Stream(func(body io.Reader) error {
+		reader := bufio.NewReader(body)
+		event := &ServerSentEvent{}
+		var data []string
+		dispatch := func() error {
+			if len(data) == 0 {
+				event = &ServerSentEvent{}
+				return nil
+			}
+			event.Data = strings.Join(data, "\n")
+			e := handle(event)
+			event, data = &ServerSentEvent{}, nil
+			return e
+		}
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+			line = strings.TrimRight(line, "\r\n")
+
+			if line == "" {
+				if e := dispatch(); e != nil {
+					return e
+				}
+			} else if !strings.HasPrefix(line, ":") {
+				field, value := line, ""
+				if i := strings.Index(line, ":"); i >= 0 {
+					field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+				}
+				switch field {
+				case "id":
+					event.Id = value
+				case "event":
+					event.Event = value
+				case "data":
+					data = append(data, value)
+				case "retry":
+					event.Retry, _ = strconv.Atoi(value)
+				}
+			}
+
+			// 未以空行结束的事件不完整，直接丢弃
+			if err == io.EOF {
+				return nil
+			}
+		}
+	})
+}
+
+// idleTimeoutReader 超过 idle 没有读到数据时取消请求
+type idleTimeoutReader struct {
+	reader io.Reader
+	idle   time.Duration
+	timer  *time.Timer
+	fired  int32
+}
+
+func newIdleTimeoutReader(reader io.Reader, idle time.Duration, cancel context.CancelFunc) *idleTimeoutReader {
+	r := &idleTimeoutReader{reader: reader, idle: idle}
+	r.timer = time.AfterFunc(idle, func() {
+		atomic.StoreInt32(&r.fired, 1)
+		cancel()
+	})
+	return r
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	if atomic.LoadInt32(&r.fired) == 1 {
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		return n, fmt.Errorf("stream idle for %s: %w", r.idle, context.DeadlineExceeded)
+	}
+	if n > 0 {
+		r.timer.Reset(r.idle)
+	}
+	return n, err
+}
+
+func (r *idleTimeoutReader) stop() {
+	r.timer.Stop()
+}
+
+// maxBytesReader 读取超过 limit 字节时返回 *contract.ResponseTooLargeError
+type maxBytesReader struct {
+	reader    io.Reader
+	limit     int64
+	remaining int64
+}
+
+func newMaxBytesReader(reader io.Reader, limit int64) *maxBytesReader {
+	return &maxBytesReader{reader: reader, limit: limit, remaining: limit}
+}
+
+func (m *maxBytesReader) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// 多读一个字节用于判断是否超限
+	if int64(len(p)) > m.remaining+1 {
+		p = p[:m.remaining+1]
+	}
+	n, err = m.reader.Read(p)
+	if int64(n) <= m.remaining {
+		m.remaining -= int64(n)
+		return n, err
+	}
+	n = int(m.remaining)
+	m.remaining = 0
+	return n, &contract.ResponseTooLargeError{Limit: m.limit}
+}
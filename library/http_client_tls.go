@@ -0,0 +1,294 @@
+package library
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newHttpTLSConfig 根据配置生成 tls.Config，未配置时返回nil使用默认配置
+func newHttpTLSConfig(conf *HttpTLSConfig) (*tls.Config, error) {
+	if conf == nil || (conf.CertFile == "" && conf.CAFile == "" && conf.MinVersion == "" &&
+		conf.ServerName == "" && !conf.InsecureSkipVerify) {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+	if conf.MinVersion != "" {
+		version, ok := tlsVersions[conf.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported tls min version %s", conf.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if (conf.CertFile == "") != (conf.KeyFile == "") {
+		return nil, errors.New("tls cert file and key file must be set together")
+	}
+	if conf.CertFile == "" && conf.CAFile == "" {
+		return tlsConfig, nil
+	}
+
+	reloader := &tlsFileReloader{
+		certFile:   conf.CertFile,
+		keyFile:    conf.KeyFile,
+		caFile:     conf.CAFile,
+		serverName: conf.ServerName,
+		interval:   time.Duration(conf.ReloadSecond) * time.Second,
+		logger:     conf.Logger,
+	}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	if conf.CertFile != "" {
+		tlsConfig.GetClientCertificate = reloader.getClientCertificate
+	}
+	if conf.CAFile == "" || conf.InsecureSkipVerify {
+		return tlsConfig, nil
+	}
+	// 不热加载时直接使用标准校验
+	if reloader.interval <= 0 {
+		tlsConfig.RootCAs = reloader.roots
+		return tlsConfig, nil
+	}
+	// 热加载的CA在握手时使用最新加载的证书池校验，Transport 每个连接都会复制 tls.Config，不能直接修改 RootCAs
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyConnection = reloader.verifyConnection
+	return tlsConfig, nil
+}
+
+// tlsFileReloader 握手时按间隔检查证书文件修改时间并重新加载，已建立的连接继续使用旧证书
+type tlsFileReloader struct {
+	certFile   string
+	keyFile    string
+	caFile     string
+	serverName string // 配置的 ServerName，优先于握手的 SNI 用于校验
+	interval   time.Duration
+	logger     *zap.Logger
+
+	lastCheck int64 // unix nano
+	lock      sync.RWMutex
+	modTime   time.Time
+	cert      *tls.Certificate
+	roots     *x509.CertPool
+}
+
+func (r *tlsFileReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("load tls key pair %s: %w", r.certFile, err)
+		}
+		cert = &pair
+	}
+	var roots *x509.CertPool
+	if r.caFile != "" {
+		content, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("load tls ca %s: %w", r.caFile, err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(content) {
+			return fmt.Errorf("load tls ca %s: no certificate found", r.caFile)
+		}
+	}
+
+	r.lock.Lock()
+	r.cert, r.roots, r.modTime = cert, roots, modTime
+	r.lock.Unlock()
+	atomic.StoreInt64(&r.lastCheck, time.Now().UnixNano())
+	return nil
+}
+
+func (r *tlsFileReloader) latestModTime() (latest time.Time, err error) {
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, fmt.Errorf("stat tls file %s: %w", file, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// maybeReload 距上次检查超过 interval 时检查文件是否变更，加载失败时继续使用旧证书
+func (r *tlsFileReloader) maybeReload() {
+	if r.interval <= 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&r.lastCheck)
+	if now-last < int64(r.interval) || !atomic.CompareAndSwapInt64(&r.lastCheck, last, now) {
+		return
+	}
+
+	modTime, err := r.latestModTime()
+	r.lock.RLock()
+	changed := err == nil && modTime.After(r.modTime)
+	r.lock.RUnlock()
+	if changed {
+		err = r.load()
+	}
+	if err != nil && r.logger != nil {
+		r.logger.Error("http client reload tls files failed",
+			zap.String("cert_file", r.certFile),
+			zap.String("ca_file", r.caFile),
+			zap.Error(err))
+	}
+}
+
+func (r *tlsFileReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.maybeReload()
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
+
+func (r *tlsFileReloader) verifyConnection(cs tls.ConnectionState) error {
+	r.maybeReload()
+	r.lock.RLock()
+	roots := r.roots
+	r.lock.RUnlock()
+
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: server did not provide a certificate")
+	}
+	// 请求IP地址时不发送 SNI，ServerName 为空，不能跳过主机名校验
+	serverName := r.serverName
+	if serverName == "" {
+		serverName = cs.ServerName
+	}
+	if serverName == "" {
+		return errors.New("tls: server name is required to verify certificate with reloaded ca")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// newHttpProxy 未配置代理地址时读取环境变量 HTTP_PROXY/HTTPS_PROXY/NO_PROXY
+func newHttpProxy(conf *HttpProxyConfig) (func(*http.Request) (*url.URL, error), error) {
+	if conf == nil || (conf.Url == "" && len(conf.NoProxy) == 0) {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	var proxyUrl *url.URL
+	if conf.Url != "" {
+		var err error
+		if proxyUrl, err = url.Parse(conf.Url); err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		if proxyUrl.Scheme == "" || proxyUrl.Host == "" {
+			return nil, fmt.Errorf("invalid proxy url %s", proxyUrl.Redacted())
+		}
+	}
+	noProxy := newNoProxyMatcher(conf.NoProxy)
+
+	return func(req *http.Request) (*url.URL, error) {
+		if noProxy.match(req.URL.Hostname()) {
+			return nil, nil
+		}
+		if proxyUrl == nil {
+			return http.ProxyFromEnvironment(req)
+		}
+		return proxyUrl, nil
+	}, nil
+}
+
+// noProxyMatcher 支持 *、IP、CIDR、域名(同时匹配子域名)及 .example.com(仅匹配子域名)
+type noProxyMatcher struct {
+	all      bool
+	ips      []net.IP
+	networks []*net.IPNet
+	domains  []string
+}
+
+func newNoProxyMatcher(entries []string) *noProxyMatcher {
+	m := &noProxyMatcher{}
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case entry == "*":
+			m.all = true
+		default:
+			if _, network, err := net.ParseCIDR(entry); err == nil {
+				m.networks = append(m.networks, network)
+			} else if ip := net.ParseIP(entry); ip != nil {
+				m.ips = append(m.ips, ip)
+			} else {
+				m.domains = append(m.domains, entry)
+			}
+		}
+	}
+	return m
+}
+
+func (m *noProxyMatcher) match(host string) bool {
+	if m.all {
+		return true
+	}
+	host = strings.ToLower(host)
+	if ip := net.ParseIP(host); ip != nil {
+		for _, item := range m.ips {
+			if item.Equal(ip) {
+				return true
+			}
+		}
+		for _, network := range m.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, domain := range m.domains {
+		if strings.HasPrefix(domain, ".") {
+			if strings.HasSuffix(host, domain) {
+				return true
+			}
+		} else if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
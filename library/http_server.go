@@ -2,39 +2,127 @@ package library
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const defaultShutdownGrace = 10 * time.Second
+
 type HttpServer struct {
 	*http.Server
+	certFile      string
+	keyFile       string
+	shutdownGrace time.Duration
+	drainDuration time.Duration
+	ready         int32
+	runOnce       sync.Once
+	serveErr      chan error
 }
 
+// Run 同步监听端口，端口占用、证书错误等直接返回，监听成功后在后台处理请求并置为就绪
+// 只能调用一次，启动失败时 Wait 返回同样的错误
 func (s *HttpServer) Run() (err error) {
+	started := false
+	s.runOnce.Do(func() {
+		started = true
+		if err = s.run(); err != nil {
+			s.serveErr <- err
+			close(s.serveErr)
+		}
+	})
+	if !started {
+		return errors.New("http server already started")
+	}
+	return
+}
+
+func (s *HttpServer) run() (err error) {
+	if s.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+		if err != nil {
+			return fmt.Errorf("http server load key pair: %w", err)
+		}
+		if s.TLSConfig == nil {
+			s.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		s.TLSConfig.Certificates = append(s.TLSConfig.Certificates, cert)
+	}
+
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("http server listen %s: %w", s.Addr, err)
+	}
+
 	go func() {
-		if err = s.Server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			err = fmt.Errorf("http.Server.ListenAndServe: %w", err)
-			return
+		var serveErr error
+		if s.certFile != "" {
+			serveErr = s.Server.ServeTLS(listener, "", "")
+		} else {
+			serveErr = s.Server.Serve(listener)
+		}
+		atomic.StoreInt32(&s.ready, 0)
+		if serveErr != nil && serveErr != http.ErrServerClosed {
+			s.serveErr <- fmt.Errorf("http.Server.Serve: %w", serveErr)
 		}
-		err = nil
+		close(s.serveErr)
 	}()
+	atomic.StoreInt32(&s.ready, 1)
 	return
 }
 
-func (s *HttpServer) Close() (err error)  {
-	if err = s.Shutdown(context.TODO()); err != nil {
+// Wait 阻塞直到服务停止，正常关闭时返回nil
+func (s *HttpServer) Wait() error {
+	return <-s.serveErr
+}
+
+// Ready 是否可以接收流量，Run 成功后为 true，Close 开始时即置为 false
+func (s *HttpServer) Ready() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+// Close 先置为未就绪并等待 ReadinessDrainSecond，再在 ShutdownGraceSecond 内等待处理中的请求完成，超时后强制关闭连接
+func (s *HttpServer) Close() (err error) {
+	atomic.StoreInt32(&s.ready, 0)
+	if s.drainDuration > 0 {
+		time.Sleep(s.drainDuration)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownGrace)
+	defer cancel()
+	if err = s.Shutdown(ctx); err != nil {
+		_ = s.Server.Close()
 		err = fmt.Errorf("server shutdown: %w", err)
 		return
 	}
 	return
 }
 
-func NewHttpServer(conf *HttpServerConfig,handler http.Handler)(server *HttpServer){
+func NewHttpServer(conf *HttpServerConfig, handler http.Handler) (server *HttpServer) {
 	server = &HttpServer{
-		&http.Server{
-			Addr: fmt.Sprintf(":%d", conf.Port),
+		Server: &http.Server{
+			Addr:              net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port)),
+			ReadTimeout:       time.Duration(conf.ReadTimeoutSecond) * time.Second,
+			ReadHeaderTimeout: time.Duration(conf.ReadHeaderTimeoutSecond) * time.Second,
+			WriteTimeout:      time.Duration(conf.WriteTimeoutSecond) * time.Second,
+			IdleTimeout:       time.Duration(conf.IdleTimeoutSecond) * time.Second,
+			MaxHeaderBytes:    conf.MaxHeaderBytes,
 		},
+		certFile:      conf.CertFile,
+		keyFile:       conf.KeyFile,
+		shutdownGrace: time.Duration(conf.ShutdownGraceSecond) * time.Second,
+		drainDuration: time.Duration(conf.ReadinessDrainSecond) * time.Second,
+		serveErr:      make(chan error, 1),
+	}
+	if server.shutdownGrace <= 0 {
+		server.shutdownGrace = defaultShutdownGrace
 	}
 	server.Handler = handler
 	return server
-}
\ No newline at end of file
+}
@@ -1,5 +1,15 @@
 package library
 
 type HttpServerConfig struct {
-	Port int
+	Port                    int
+	Host                    string // 监听地址，为空时监听所有网卡
+	ReadTimeoutSecond       int    // 读取整个请求(含body)的超时时间，0不限制
+	ReadHeaderTimeoutSecond int    // 读取请求头超时时间，默认同 ReadTimeoutSecond
+	WriteTimeoutSecond      int    // 写响应超时时间，0不限制
+	IdleTimeoutSecond       int    // keep-alive 空闲连接超时时间，默认同 ReadTimeoutSecond
+	MaxHeaderBytes          int    // 请求头最大字节数，默认1MB
+	CertFile                string // 证书，与 KeyFile 同时设置时开启 https
+	KeyFile                 string // 私钥
+	ShutdownGraceSecond     int    // 关闭时等待处理中请求完成的最长时间，默认10s
+	ReadinessDrainSecond    int    // 关闭时先将就绪状态置为失败，等待负载均衡摘除流量的时间，默认0
 }
@@ -0,0 +1,207 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"google.golang.org/protobuf/proto"
+)
+
+const defaultKafkaCloseTimeout = 10 * time.Second
+
+var errKafkaAsyncProducerClosed = errors.New("kafka async producer is closed")
+
+// kafkaAsyncMetadata 发送期间替换消息的 Metadata 以保存span，回调前还原
+type kafkaAsyncMetadata struct {
+	span     SpanInterface
+	metadata interface{}
+}
+
+// KafkaAsyncProducer 异步发送，结果通过 OnSuccess/OnError 回调
+type KafkaAsyncProducer struct {
+	sarama.AsyncProducer
+	client       sarama.Client
+	metrics      *Metrics
+	peer         string
+	onSuccess    func(msg *sarama.ProducerMessage)
+	onError      func(producerErr *sarama.ProducerError)
+	closeTimeout time.Duration
+
+	lock    sync.RWMutex
+	closed  bool
+	done    chan struct{}  // Close 时关闭，唤醒等待缓冲的发送
+	sending sync.WaitGroup // 等待放入缓冲的发送，全部返回后才能关闭 Input
+	drain   sync.WaitGroup
+}
+
+func NewKafkaAsyncProducer(config *KafkaAsyncProducerConfig) (producer *KafkaAsyncProducer, err error) {
+	if config.ExtraConfig == nil {
+		config.ExtraConfig = sarama.NewConfig()
+	}
+
+	if config.ConsoleDebug == true {
+		sarama.Logger = log.New(os.Stdout, "["+config.Name+"]", log.LstdFlags)
+	}
+
+	config.ExtraConfig.Version, err = sarama.ParseKafkaVersion(config.Version)
+	if err != nil {
+		err = fmt.Errorf("[%s] version string is err: %w", config.Name, err)
+		return
+	}
+	config.ExtraConfig.Producer.Return.Successes = true
+	config.ExtraConfig.Producer.Return.Errors = true
+
+	if config.BrokerAddress == nil || len(config.BrokerAddress) == 0 {
+		err = fmt.Errorf("[%s] brokerAddress is empty", config.Name)
+		return
+	}
+
+	client, e := sarama.NewClient(config.BrokerAddress, config.ExtraConfig)
+	if e != nil {
+		err = fmt.Errorf("[%s] new client is error: %w", config.Name, e)
+		return
+	}
+	asyncProducer, e := sarama.NewAsyncProducerFromClient(client)
+	if e != nil {
+		_ = client.Close()
+		err = fmt.Errorf("[%s] new async producer is error: %w", config.Name, e)
+		return
+	}
+
+	producer = &KafkaAsyncProducer{
+		AsyncProducer: asyncProducer,
+		client:        client,
+		metrics:       config.Metrics,
+		peer:          strings.Join(config.BrokerAddress, ","),
+		onSuccess:     config.OnSuccess,
+		onError:       config.OnError,
+		closeTimeout:  time.Duration(config.CloseTimeoutSecond) * time.Second,
+		done:          make(chan struct{}),
+	}
+	if producer.closeTimeout <= 0 {
+		producer.closeTimeout = defaultKafkaCloseTimeout
+	}
+	producer.drain.Add(2)
+	go producer.handleSuccesses()
+	go producer.handleErrors()
+	return
+}
+
+func (producer *KafkaAsyncProducer) handleSuccesses() {
+	defer producer.drain.Done()
+	for msg := range producer.AsyncProducer.Successes() {
+		producer.finish(msg, nil)
+		if producer.onSuccess != nil {
+			producer.onSuccess(msg)
+		}
+	}
+}
+
+func (producer *KafkaAsyncProducer) handleErrors() {
+	defer producer.drain.Done()
+	for producerErr := range producer.AsyncProducer.Errors() {
+		producer.finish(producerErr.Msg, producerErr.Err)
+		if producer.onError != nil {
+			producer.onError(producerErr)
+		}
+	}
+}
+
+// finish 结束span、记录指标并还原消息的 Metadata
+func (producer *KafkaAsyncProducer) finish(msg *sarama.ProducerMessage, err error) {
+	if msg == nil {
+		return
+	}
+	if meta, ok := msg.Metadata.(*kafkaAsyncMetadata); ok {
+		endKafkaSpan(meta.span, err)
+		msg.Metadata = meta.metadata
+	}
+	if producer.metrics != nil {
+		producer.metrics.ObserveKafkaProduce(msg.Topic, err)
+	}
+}
+
+// SendMessageCtx 将消息放入发送缓冲，缓冲已满时等待到 ctx 超时、取消或 Close，返回nil不代表发送成功
+func (producer *KafkaAsyncProducer) SendMessageCtx(ctx context.Context, msg *sarama.ProducerMessage) error {
+	producer.lock.RLock()
+	if producer.closed {
+		producer.lock.RUnlock()
+		return errKafkaAsyncProducerClosed
+	}
+	producer.sending.Add(1)
+	producer.lock.RUnlock()
+	defer producer.sending.Done()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	span := startKafkaProducerSpan(ctx, msg, producer.peer)
+	meta := &kafkaAsyncMetadata{span: span, metadata: msg.Metadata}
+	msg.Metadata = meta
+	var err error
+	select {
+	case producer.AsyncProducer.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		err = fmt.Errorf("send kafka message to %s: %w", msg.Topic, ctx.Err())
+	case <-producer.done:
+		err = errKafkaAsyncProducerClosed
+	}
+	msg.Metadata = meta.metadata
+	endKafkaSpan(span, err)
+	return err
+}
+
+func (producer *KafkaAsyncProducer) SendJSON(ctx context.Context, topic string, value interface{}, opts ...KafkaSendOption) error {
+	msg, err := NewKafkaJSONMessage(topic, value, opts...)
+	if err != nil {
+		return err
+	}
+	return producer.SendMessageCtx(ctx, msg)
+}
+
+func (producer *KafkaAsyncProducer) SendProto(ctx context.Context, topic string, value proto.Message, opts ...KafkaSendOption) error {
+	msg, err := NewKafkaProtoMessage(topic, value, opts...)
+	if err != nil {
+		return err
+	}
+	return producer.SendMessageCtx(ctx, msg)
+}
+
+// Close 停止接收新消息，等待缓冲中的消息发送完成并回调后关闭，超过 CloseTimeoutSecond 时返回错误
+func (producer *KafkaAsyncProducer) Close() (err error) {
+	producer.lock.Lock()
+	if producer.closed {
+		producer.lock.Unlock()
+		return nil
+	}
+	producer.closed = true
+	close(producer.done)
+	producer.lock.Unlock()
+
+	// 等待缓冲的发送已被 done 唤醒，全部返回后才能关闭 Input
+	producer.sending.Wait()
+	producer.AsyncProducer.AsyncClose()
+	drained := make(chan struct{})
+	go func() {
+		producer.drain.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(producer.closeTimeout):
+		err = fmt.Errorf("kafka async producer flush timeout after %s", producer.closeTimeout)
+	}
+	if e := producer.client.Close(); err == nil && e != sarama.ErrClosedClient {
+		err = e
+	}
+	return
+}
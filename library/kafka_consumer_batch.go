@@ -0,0 +1,213 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	defaultKafkaBatchSize = 100
+	defaultKafkaBatchWait = time.Second
+)
+
+// KafkaBatchError 批量处理部分失败时返回，Errors 的key为传入的消息，未包含的消息视为处理成功
+// 返回其他错误时视为整批失败
+type KafkaBatchError struct {
+	Errors map[*sarama.ConsumerMessage]error
+}
+
+// Fail 记录处理失败的消息
+func (e *KafkaBatchError) Fail(msg *sarama.ConsumerMessage, err error) {
+	if e.Errors == nil {
+		e.Errors = make(map[*sarama.ConsumerMessage]error)
+	}
+	e.Errors[msg] = err
+}
+
+func (e *KafkaBatchError) Error() string {
+	for msg, err := range e.Errors {
+		return fmt.Sprintf("%d messages of batch failed, e.g. %s/%d at offset %d: %v", len(e.Errors), msg.Topic, msg.Partition, msg.Offset, err)
+	}
+	return "batch failed"
+}
+
+// batchFailures 将批量处理的错误展开为每条消息的错误
+func batchFailures(msgs []*sarama.ConsumerMessage, err error) map[*sarama.ConsumerMessage]error {
+	if err == nil {
+		return nil
+	}
+	failed := make(map[*sarama.ConsumerMessage]error)
+	var batchErr *KafkaBatchError
+	if errors.As(err, &batchErr) && len(batchErr.Errors) > 0 {
+		for _, msg := range msgs {
+			if msgErr, ok := batchErr.Errors[msg]; ok {
+				failed[msg] = msgErr
+			}
+		}
+		return failed
+	}
+	for _, msg := range msgs {
+		failed[msg] = err
+	}
+	return failed
+}
+
+// handleBatch 批量处理及重试，部分失败时只重试失败的消息
+// 返回重试用尽后仍失败的消息、重试次数，ok 为false表示处理失败时或重试等待过程中ctx已取消
+func (p *kafkaFailurePolicy) handleBatch(ctx context.Context, msgs []*sarama.ConsumerMessage, handle MessageBatchHandleFun) (failed map[*sarama.ConsumerMessage]error, retries int, ok bool) {
+	failed = make(map[*sarama.ConsumerMessage]error)
+	pending := msgs
+	for {
+		var retryable []*sarama.ConsumerMessage
+		errs := batchFailures(pending, handle(ctx, pending))
+		// 关闭或rebalance导致的失败不重试也不按失败策略处理
+		if len(errs) > 0 && ctx.Err() != nil {
+			return failed, retries, false
+		}
+		for _, msg := range pending {
+			err, isFailed := errs[msg]
+			if !isFailed {
+				continue
+			}
+			failed[msg] = err
+			if retries < p.maxRetries && (p.retryable == nil || p.retryable(err)) {
+				retryable = append(retryable, msg)
+			}
+		}
+		if len(retryable) == 0 {
+			return failed, retries, true
+		}
+
+		retries++
+		timer := time.NewTimer(p.backoff(retries))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return failed, retries, false
+		case <-timer.C:
+		}
+		for _, msg := range retryable {
+			delete(failed, msg)
+		}
+		pending = retryable
+	}
+}
+
+// consumeBatch 达到 BatchSize 或首条消息等待超过 BatchWaitMillisecond 时批量处理，处理完成后提交到该批最后一条消息
+func (h *GroupConsumerHandler) consumeBatch(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	size := h.batchSize
+	if size <= 0 {
+		size = defaultKafkaBatchSize
+	}
+	wait := h.batchWait
+	if wait <= 0 {
+		wait = defaultKafkaBatchWait
+	}
+
+	var (
+		batch   []*sarama.ConsumerMessage // 原始消息，用于提交位移
+		origins []*sarama.ConsumerMessage // 重试topic中的消息还原后传给处理函数
+		timer   *time.Timer
+		timeout <-chan time.Time
+	)
+	flush := func() bool {
+		if timer != nil {
+			timer.Stop()
+			timeout = nil
+		}
+		ok := h.handleBatchMessages(session, batch, origins)
+		batch, origins = nil, nil
+		return ok
+	}
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				if len(batch) > 0 {
+					flush()
+				}
+				return nil
+			}
+			if h.metrics != nil {
+				h.metrics.SetKafkaLag(msg.Topic, msg.Partition, claim.HighWaterMarkOffset()-msg.Offset-1)
+			}
+			origin := kafkaRetryOrigin(session.Context(), msg)
+			if origin == nil {
+				return nil
+			}
+			batch = append(batch, msg)
+			origins = append(origins, origin)
+			if len(batch) == 1 {
+				timer = time.NewTimer(wait)
+				timeout = timer.C
+			}
+			if len(batch) >= size && !flush() {
+				return drainKafkaClaim(session, claim)
+			}
+		case <-timeout:
+			if !flush() {
+				return drainKafkaClaim(session, claim)
+			}
+		case <-session.Context().Done():
+			// 未处理的消息不提交，rebalance后重新消费
+			return nil
+		}
+	}
+}
+
+// handleBatchMessages 处理一批消息，重试用尽的消息逐条按失败策略处理，返回false时停止消费该分区
+func (h *GroupConsumerHandler) handleBatchMessages(session sarama.ConsumerGroupSession, batch, origins []*sarama.ConsumerMessage) bool {
+	policy := h.failurePolicy
+	if policy == nil {
+		policy = &kafkaFailurePolicy{action: KafkaFailureSkip}
+	}
+	ctx, span := startKafkaConsumerSpan(session.Context(), origins[0], h.groupName, h.peer)
+	if span != nil {
+		span.Tag("mq.batch_size", strconv.Itoa(len(batch)))
+	}
+
+	failed, retries, ok := policy.handleBatch(ctx, origins, h.handleMessageBatch)
+	if !ok || (len(failed) > 0 && session.Context().Err() != nil) {
+		// 整批不提交位移，rebalance后重新消费
+		endKafkaSpan(span, ctx.Err())
+		return false
+	}
+
+	var (
+		last     *sarama.ConsumerMessage
+		firstErr error
+	)
+	for i, origin := range origins {
+		err := failed[origin]
+		if err != nil && !policy.fail(ctx, origin, err, retries) {
+			// 只提交失败消息之前的位移
+			if last != nil {
+				session.MarkMessage(last, "")
+			}
+			endKafkaSpan(span, err)
+			if h.metrics != nil {
+				h.metrics.ObserveKafkaConsume(origin.Topic, err)
+			}
+			if session.Context().Err() == nil && h.handleConsumeErr != nil {
+				h.handleConsumeErr(fmt.Errorf("stop consuming %s/%d at offset %d: %w", batch[i].Topic, batch[i].Partition, batch[i].Offset, err))
+			}
+			return false
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if h.metrics != nil {
+			h.metrics.ObserveKafkaConsume(origin.Topic, err)
+		}
+		last = batch[i]
+	}
+	session.MarkMessage(last, "")
+	endKafkaSpan(span, firstErr)
+	return true
+}
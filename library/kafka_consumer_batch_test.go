@@ -0,0 +1,125 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func newTestBatch(n int) []*sarama.ConsumerMessage {
+	msgs := make([]*sarama.ConsumerMessage, n)
+	for i := range msgs {
+		msgs[i] = &sarama.ConsumerMessage{Topic: "order", Offset: int64(i)}
+	}
+	return msgs
+}
+
+// batchCalls 记录每次调用处理函数时传入的位移
+type batchCalls [][]int64
+
+func (c *batchCalls) record(msgs []*sarama.ConsumerMessage) {
+	offsets := make([]int64, 0, len(msgs))
+	for _, msg := range msgs {
+		offsets = append(offsets, msg.Offset)
+	}
+	*c = append(*c, offsets)
+}
+
+func TestHandleBatchRetriesOnlyFailedMessages(t *testing.T) {
+	policy := &kafkaFailurePolicy{maxRetries: 2, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+	msgs := newTestBatch(3)
+
+	var calls batchCalls
+	failed, retries, ok := policy.handleBatch(context.Background(), msgs, func(ctx context.Context, batch []*sarama.ConsumerMessage) error {
+		calls.record(batch)
+		if len(calls) > 1 {
+			return nil
+		}
+		batchErr := &KafkaBatchError{}
+		batchErr.Fail(msgs[1], errors.New("timeout"))
+		return batchErr
+	})
+
+	if !ok || retries != 1 || len(failed) != 0 {
+		t.Fatalf("got failed %v, retries %d, ok %v", failed, retries, ok)
+	}
+	if want := (batchCalls{{0, 1, 2}, {1}}); !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls %v, want %v", calls, want)
+	}
+}
+
+func TestHandleBatchPlainErrorFailsWholeBatch(t *testing.T) {
+	policy := &kafkaFailurePolicy{maxRetries: 2, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+	msgs := newTestBatch(2)
+	handleErr := errors.New("db down")
+
+	var calls batchCalls
+	failed, retries, ok := policy.handleBatch(context.Background(), msgs, func(ctx context.Context, batch []*sarama.ConsumerMessage) error {
+		calls.record(batch)
+		return handleErr
+	})
+
+	if !ok || retries != 2 {
+		t.Fatalf("got retries %d, ok %v", retries, ok)
+	}
+	if len(failed) != 2 || failed[msgs[0]] != handleErr || failed[msgs[1]] != handleErr {
+		t.Fatalf("failed %v, want both messages", failed)
+	}
+	if want := (batchCalls{{0, 1}, {0, 1}, {0, 1}}); !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls %v, want %v", calls, want)
+	}
+}
+
+func TestHandleBatchSkipsNonRetryable(t *testing.T) {
+	errInvalid := errors.New("invalid message")
+	policy := &kafkaFailurePolicy{
+		maxRetries:     2,
+		initialBackoff: time.Millisecond,
+		maxBackoff:     time.Millisecond,
+		retryable:      func(err error) bool { return !errors.Is(err, errInvalid) },
+	}
+	msgs := newTestBatch(3)
+
+	var calls batchCalls
+	failed, retries, ok := policy.handleBatch(context.Background(), msgs, func(ctx context.Context, batch []*sarama.ConsumerMessage) error {
+		calls.record(batch)
+		if len(calls) > 1 {
+			return nil
+		}
+		batchErr := &KafkaBatchError{}
+		batchErr.Fail(msgs[0], errInvalid)
+		batchErr.Fail(msgs[2], errors.New("timeout"))
+		return batchErr
+	})
+
+	if !ok || retries != 1 {
+		t.Fatalf("got retries %d, ok %v", retries, ok)
+	}
+	if len(failed) != 1 || failed[msgs[0]] != errInvalid {
+		t.Fatalf("failed %v, want only offset 0", failed)
+	}
+	if want := (batchCalls{{0, 1, 2}, {2}}); !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls %v, want %v", calls, want)
+	}
+}
+
+func TestHandleBatchCancelled(t *testing.T) {
+	policy := &kafkaFailurePolicy{maxRetries: 2, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	_, _, ok := policy.handleBatch(ctx, newTestBatch(2), func(ctx context.Context, batch []*sarama.ConsumerMessage) error {
+		calls++
+		cancel()
+		return ctx.Err()
+	})
+
+	// rebalance导致的失败不重试，也不交给失败策略
+	if ok || calls != 1 {
+		t.Fatalf("got ok %v, calls %d", ok, calls)
+	}
+}
@@ -0,0 +1,250 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+)
+
+// 本地重试及重试topic都用尽后的处理方式
+const (
+	KafkaFailureSkip          = "skip"           // 记录日志后提交位移，继续消费
+	KafkaFailureDeadLetter    = "dead_letter"    // 转发到死信topic后提交位移
+	KafkaFailureStopPartition = "stop_partition" // 不提交位移并停止处理该分区，其它分区不受影响，下次rebalance后从失败位置重新消费
+)
+
+const (
+	defaultKafkaRetryBackoff    = 100 * time.Millisecond
+	defaultKafkaRetryMaxBackoff = 10 * time.Second
+	defaultDeadLetterSuffix     = ".DLQ"
+)
+
+// 转发到死信、重试topic时附加的消息头
+const (
+	KafkaHeaderOriginalTopic     = "x-original-topic"
+	KafkaHeaderOriginalPartition = "x-original-partition"
+	KafkaHeaderOriginalOffset    = "x-original-offset"
+	KafkaHeaderError             = "x-error"
+	KafkaHeaderRetries           = "x-retries"
+	KafkaHeaderRetryStage        = "x-retry-stage" // 已经过的重试topic个数
+	KafkaHeaderRetryAt           = "x-retry-at"    // 重试topic中的消息可以处理的时间，毫秒时间戳
+)
+
+// kafkaFailurePolicy 由 KafkaFailureConfig 解析得到的消费失败策略
+type kafkaFailurePolicy struct {
+	maxRetries      int
+	initialBackoff  time.Duration
+	maxBackoff      time.Duration
+	retryDelays     []time.Duration
+	action          string
+	retryable       func(err error) bool
+	deadLetterTopic string
+	producer        *KafkaSyncProducer
+	logger          *Log
+}
+
+func newKafkaFailurePolicy(conf *KafkaFailureConfig) (*kafkaFailurePolicy, error) {
+	policy := &kafkaFailurePolicy{action: KafkaFailureSkip}
+	if conf == nil {
+		return policy, nil
+	}
+
+	policy.maxRetries = conf.MaxRetries
+	policy.initialBackoff = time.Duration(conf.InitialBackoffMillisecond) * time.Millisecond
+	policy.maxBackoff = time.Duration(conf.MaxBackoffMillisecond) * time.Millisecond
+	policy.retryable = conf.Retryable
+	policy.deadLetterTopic = conf.DeadLetterTopic
+	policy.producer = conf.Producer
+	policy.logger = conf.Logger
+	for _, delay := range conf.RetryDelaySeconds {
+		if delay <= 0 {
+			return nil, fmt.Errorf("retry delay must be positive, got %d", delay)
+		}
+		policy.retryDelays = append(policy.retryDelays, time.Duration(delay)*time.Second)
+	}
+	if policy.initialBackoff <= 0 {
+		policy.initialBackoff = defaultKafkaRetryBackoff
+	}
+	if policy.maxBackoff <= 0 {
+		policy.maxBackoff = defaultKafkaRetryMaxBackoff
+	}
+
+	switch conf.Action {
+	case "", KafkaFailureSkip:
+	case KafkaFailureDeadLetter, KafkaFailureStopPartition:
+		policy.action = conf.Action
+	default:
+		return nil, fmt.Errorf("unsupported kafka failure action %s", conf.Action)
+	}
+	return policy, nil
+}
+
+// needProducer 是否需要发送重试、死信消息
+func (p *kafkaFailurePolicy) needProducer() bool {
+	return len(p.retryDelays) > 0 || p.action == KafkaFailureDeadLetter
+}
+
+// retryTopics 需要额外订阅的重试topic
+func (p *kafkaFailurePolicy) retryTopics(topics []string) []string {
+	var retryTopics []string
+	for _, topic := range topics {
+		for _, delay := range p.retryDelays {
+			retryTopics = append(retryTopics, kafkaRetryTopic(topic, delay))
+		}
+	}
+	return retryTopics
+}
+
+// kafkaRetryTopic 重试topic名称，如 order.retry.60s
+func kafkaRetryTopic(topic string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%ds", topic, int64(delay/time.Second))
+}
+
+// backoff 第n次重试前的等待时间，指数增长
+func (p *kafkaFailurePolicy) backoff(retry int) time.Duration {
+	backoff := p.initialBackoff << uint(retry-1)
+	if backoff <= 0 || backoff > p.maxBackoff {
+		backoff = p.maxBackoff
+	}
+	return backoff
+}
+
+// handle 执行消息处理及重试，返回是否可以提交位移及最终的错误
+func (p *kafkaFailurePolicy) handle(ctx context.Context, msg *sarama.ConsumerMessage, handle MessageHandleCtxFun) (commit bool, err error) {
+	retries := 0
+	for {
+		if err = handle(ctx, msg); err == nil {
+			return true, nil
+		}
+		// 关闭或rebalance导致的失败不重试也不按失败策略处理，不提交位移，消息会被重新消费
+		if ctx.Err() != nil {
+			return false, err
+		}
+		if retries >= p.maxRetries || (p.retryable != nil && !p.retryable(err)) {
+			break
+		}
+		retries++
+		timer := time.NewTimer(p.backoff(retries))
+		select {
+		case <-ctx.Done():
+			// 关闭或rebalance，不提交位移，消息会被重新消费
+			timer.Stop()
+			return false, err
+		case <-timer.C:
+		}
+	}
+	return p.fail(ctx, msg, err, retries), err
+}
+
+// fail 本地重试用尽后转发到下一个重试topic，都用尽或错误不可重试时按配置处理，返回是否可以提交位移
+func (p *kafkaFailurePolicy) fail(ctx context.Context, msg *sarama.ConsumerMessage, err error, retries int) bool {
+	fields := []zap.Field{
+		zap.String("topic", msg.Topic),
+		zap.Int32("partition", msg.Partition),
+		zap.Int64("offset", msg.Offset),
+		zap.Int("retries", retries),
+		zap.Error(err),
+	}
+	if stage := kafkaRetryStage(msg); stage < len(p.retryDelays) && (p.retryable == nil || p.retryable(err)) {
+		delay := p.retryDelays[stage]
+		topic := kafkaRetryTopic(msg.Topic, delay)
+		retryMsg := newKafkaFailedMessage(topic, msg, err, retries)
+		setKafkaHeader(retryMsg, KafkaHeaderRetryStage, strconv.Itoa(stage+1))
+		setKafkaHeader(retryMsg, KafkaHeaderRetryAt, strconv.FormatInt(time.Now().Add(delay).UnixNano()/int64(time.Millisecond), 10))
+		if _, _, sendErr := p.producer.SendMessageCtx(ctx, retryMsg); sendErr != nil {
+			p.log(ctx, "kafka retry send failed", append(fields, zap.String("retry_topic", topic), zap.NamedError("send_error", sendErr))...)
+			return false
+		}
+		p.log(ctx, "kafka message sent to retry topic", append(fields, zap.String("retry_topic", topic))...)
+		return true
+	}
+
+	fields = append(fields, zap.String("action", p.action))
+	switch p.action {
+	case KafkaFailureDeadLetter:
+		topic := p.deadLetterTopic
+		if topic == "" {
+			topic = msg.Topic + defaultDeadLetterSuffix
+		}
+		if _, _, sendErr := p.producer.SendMessageCtx(ctx, newKafkaFailedMessage(topic, msg, err, retries)); sendErr != nil {
+			// 死信发送失败时不提交位移，避免丢失消息
+			p.log(ctx, "kafka dead letter send failed", append(fields, zap.NamedError("send_error", sendErr))...)
+			return false
+		}
+		p.log(ctx, "kafka message sent to dead letter", append(fields, zap.String("dead_letter_topic", topic))...)
+		return true
+	case KafkaFailureStopPartition:
+		p.log(ctx, "kafka partition stopped", fields...)
+		return false
+	}
+	p.log(ctx, "kafka message skipped", fields...)
+	return true
+}
+
+func (p *kafkaFailurePolicy) log(ctx context.Context, msg string, fields ...zap.Field) {
+	if p.logger != nil {
+		p.logger.ErrorCtx(ctx, msg, fields...)
+	}
+}
+
+// kafkaRetryStage 消息已经过的重试topic个数
+func kafkaRetryStage(msg *sarama.ConsumerMessage) int {
+	stage, _ := strconv.Atoi(getKafkaHeader(msg.Headers, KafkaHeaderRetryStage))
+	return stage
+}
+
+// kafkaRetryOrigin 重试topic中的消息，等待到可处理时间后还原为原消息的topic、分区及位移
+// 返回nil表示等待过程中ctx已取消
+func kafkaRetryOrigin(ctx context.Context, msg *sarama.ConsumerMessage) *sarama.ConsumerMessage {
+	originTopic := getKafkaHeader(msg.Headers, KafkaHeaderOriginalTopic)
+	if originTopic == "" || kafkaRetryStage(msg) == 0 {
+		return msg
+	}
+	if retryAt, err := strconv.ParseInt(getKafkaHeader(msg.Headers, KafkaHeaderRetryAt), 10, 64); err == nil {
+		if wait := time.Until(time.Unix(0, retryAt*int64(time.Millisecond))); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case <-timer.C:
+			}
+		}
+	}
+
+	origin := *msg
+	origin.Topic = originTopic
+	if partition, err := strconv.ParseInt(getKafkaHeader(msg.Headers, KafkaHeaderOriginalPartition), 10, 32); err == nil {
+		origin.Partition = int32(partition)
+	}
+	if offset, err := strconv.ParseInt(getKafkaHeader(msg.Headers, KafkaHeaderOriginalOffset), 10, 64); err == nil {
+		origin.Offset = offset
+	}
+	return &origin
+}
+
+// newKafkaFailedMessage 复制原消息并附加原始位置及错误信息
+func newKafkaFailedMessage(topic string, msg *sarama.ConsumerMessage, err error, retries int) *sarama.ProducerMessage {
+	failed := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(msg.Value),
+	}
+	if msg.Key != nil {
+		failed.Key = sarama.ByteEncoder(msg.Key)
+	}
+	for _, header := range msg.Headers {
+		if header != nil {
+			failed.Headers = append(failed.Headers, *header)
+		}
+	}
+	setKafkaHeader(failed, KafkaHeaderOriginalTopic, msg.Topic)
+	setKafkaHeader(failed, KafkaHeaderOriginalPartition, strconv.Itoa(int(msg.Partition)))
+	setKafkaHeader(failed, KafkaHeaderOriginalOffset, strconv.FormatInt(msg.Offset, 10))
+	setKafkaHeader(failed, KafkaHeaderError, err.Error())
+	setKafkaHeader(failed, KafkaHeaderRetries, strconv.Itoa(retries))
+	return failed
+}
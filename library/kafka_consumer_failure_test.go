@@ -0,0 +1,155 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// recordSyncProducer 记录发送的消息
+type recordSyncProducer struct {
+	sarama.SyncProducer
+	sent []*sarama.ProducerMessage
+}
+
+func (p *recordSyncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	p.sent = append(p.sent, msg)
+	return 0, int64(len(p.sent) - 1), nil
+}
+
+// consumedFrom 模拟从重试topic中消费到已发送的消息
+func consumedFrom(t *testing.T, msg *sarama.ProducerMessage, offset int64) *sarama.ConsumerMessage {
+	t.Helper()
+	consumed := &sarama.ConsumerMessage{Topic: msg.Topic, Offset: offset}
+	var err error
+	if msg.Key != nil {
+		if consumed.Key, err = msg.Key.Encode(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if consumed.Value, err = msg.Value.Encode(); err != nil {
+		t.Fatal(err)
+	}
+	for i := range msg.Headers {
+		header := msg.Headers[i]
+		consumed.Headers = append(consumed.Headers, &header)
+	}
+	return consumed
+}
+
+func countKafkaHeader(headers []sarama.RecordHeader, key string) int {
+	count := 0
+	for _, header := range headers {
+		if string(header.Key) == key {
+			count++
+		}
+	}
+	return count
+}
+
+func TestKafkaRetryTopicHeaderRoundTrip(t *testing.T) {
+	producer := &recordSyncProducer{}
+	policy := &kafkaFailurePolicy{
+		retryDelays: []time.Duration{time.Second, time.Minute},
+		action:      KafkaFailureSkip,
+		producer:    &KafkaSyncProducer{SyncProducer: producer},
+	}
+	original := &sarama.ConsumerMessage{
+		Topic:     "order",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("order-1"),
+		Value:     []byte(`{"id":1}`),
+		Headers:   []*sarama.RecordHeader{{Key: []byte("x-request-id"), Value: []byte("abc")}},
+	}
+
+	// 第一次失败转发到第一个重试topic
+	before := time.Now()
+	if !policy.fail(context.Background(), original, errors.New("timeout"), 2) {
+		t.Fatal("fail returned false, want commit")
+	}
+	if len(producer.sent) != 1 || producer.sent[0].Topic != "order.retry.1s" {
+		t.Fatalf("sent %+v, want order.retry.1s", producer.sent)
+	}
+	retryMsg := consumedFrom(t, producer.sent[0], 7)
+	if stage := kafkaRetryStage(retryMsg); stage != 1 {
+		t.Fatalf("retry stage %d, want 1", stage)
+	}
+	if retries := getKafkaHeader(retryMsg.Headers, KafkaHeaderRetries); retries != "2" {
+		t.Fatalf("retries header %q, want 2", retries)
+	}
+	retryAt, err := strconv.ParseInt(getKafkaHeader(retryMsg.Headers, KafkaHeaderRetryAt), 10, 64)
+	if err != nil || retryAt < before.Add(time.Second).UnixNano()/int64(time.Millisecond) {
+		t.Fatalf("retry at %d, err %v", retryAt, err)
+	}
+
+	// 未到可处理时间时等待，ctx取消返回nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if origin := kafkaRetryOrigin(ctx, retryMsg); origin != nil {
+		t.Fatalf("origin %+v before retry time, want nil", origin)
+	}
+
+	// 模拟延迟已到
+	for _, header := range retryMsg.Headers {
+		if string(header.Key) == KafkaHeaderRetryAt {
+			header.Value = []byte(strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10))
+		}
+	}
+	origin := kafkaRetryOrigin(context.Background(), retryMsg)
+	if origin.Topic != "order" || origin.Partition != 3 || origin.Offset != 42 {
+		t.Fatalf("origin %s/%d at %d, want order/3 at 42", origin.Topic, origin.Partition, origin.Offset)
+	}
+	if string(origin.Key) != "order-1" || string(origin.Value) != `{"id":1}` || getKafkaHeader(origin.Headers, "x-request-id") != "abc" {
+		t.Fatalf("origin content not preserved: %+v", origin)
+	}
+
+	// 再次失败进入下一个重试topic，原始位置不变且消息头不重复
+	if !policy.fail(context.Background(), origin, errors.New("timeout again"), 0) {
+		t.Fatal("fail returned false, want commit")
+	}
+	if len(producer.sent) != 2 || producer.sent[1].Topic != "order.retry.60s" {
+		t.Fatalf("sent %+v, want order.retry.60s", producer.sent)
+	}
+	second := producer.sent[1]
+	for _, key := range []string{KafkaHeaderOriginalTopic, KafkaHeaderOriginalOffset, KafkaHeaderRetryStage, KafkaHeaderError} {
+		if count := countKafkaHeader(second.Headers, key); count != 1 {
+			t.Fatalf("header %s appears %d times", key, count)
+		}
+	}
+	secondMsg := consumedFrom(t, second, 0)
+	if kafkaRetryStage(secondMsg) != 2 || getKafkaHeader(secondMsg.Headers, KafkaHeaderOriginalOffset) != "42" || getKafkaHeader(secondMsg.Headers, KafkaHeaderError) != "timeout again" {
+		t.Fatalf("second retry headers %+v", second.Headers)
+	}
+
+	// 重试topic用尽后按 action 处理
+	if !policy.fail(context.Background(), secondMsg, errors.New("timeout"), 0) || len(producer.sent) != 2 {
+		t.Fatalf("exhausted retry topics sent %d messages", len(producer.sent))
+	}
+}
+
+func TestKafkaNonRetryableSkipsRetryTopics(t *testing.T) {
+	errInvalid := errors.New("invalid message")
+	producer := &recordSyncProducer{}
+	policy := &kafkaFailurePolicy{
+		retryDelays: []time.Duration{time.Second},
+		action:      KafkaFailureDeadLetter,
+		retryable:   func(err error) bool { return !errors.Is(err, errInvalid) },
+		producer:    &KafkaSyncProducer{SyncProducer: producer},
+	}
+	msg := &sarama.ConsumerMessage{Topic: "order", Partition: 1, Offset: 5, Value: []byte("bad")}
+
+	if !policy.fail(context.Background(), msg, errInvalid, 0) {
+		t.Fatal("fail returned false, want commit")
+	}
+	if len(producer.sent) != 1 || producer.sent[0].Topic != "order"+defaultDeadLetterSuffix {
+		t.Fatalf("sent %+v, want dead letter only", producer.sent)
+	}
+	if stage := getKafkaHeader(consumedFrom(t, producer.sent[0], 0).Headers, KafkaHeaderRetryStage); stage != "" {
+		t.Fatalf("dead letter has retry stage %q", stage)
+	}
+}
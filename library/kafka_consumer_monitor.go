@@ -0,0 +1,222 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+)
+
+// rebalance 事件类型
+const (
+	KafkaPartitionsAssigned = "assigned" // 新的分配生效，Setup 时触发
+	KafkaPartitionsRevoked  = "revoked"  // 分配被收回，Cleanup 时触发
+)
+
+// KafkaRebalanceEvent 消费组 rebalance 事件
+type KafkaRebalanceEvent struct {
+	Type         string
+	MemberId     string
+	GenerationId int32
+	Claims       map[string][]int32 // 当前实例分配到的分区
+}
+
+type RebalanceHandleFun func(event KafkaRebalanceEvent)
+
+// GroupErrHandleFunc 消费组的非致命错误，如提交位移失败，出现后消费仍会继续
+type GroupErrHandleFunc func(error)
+
+// KafkaPartitionLag 单个分区的消费延迟
+type KafkaPartitionLag struct {
+	Topic         string `json:"topic"`
+	Partition     int32  `json:"partition"`
+	Committed     int64  `json:"committed"` // 消费组已提交的位移，-1表示未提交
+	HighWaterMark int64  `json:"high_water_mark"`
+	Lag           int64  `json:"lag"`
+	Assigned      bool   `json:"assigned"` // 是否分配给当前实例
+}
+
+// SetRebalanceHandleFunc rebalance 时回调，在消费协程中执行，不应阻塞
+func (c *KafkaGroupConsumer) SetRebalanceHandleFunc(f RebalanceHandleFun) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.rebalanceHandle = f
+}
+
+// SetGroupErrorHandleFunc 消费组的非致命错误回调，未设置时只记录日志
+func (c *KafkaGroupConsumer) SetGroupErrorHandleFunc(f GroupErrHandleFunc) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.groupErrHandle = f
+}
+
+// Assignments 当前实例分配到的分区，未加入消费组时为空
+func (c *KafkaGroupConsumer) Assignments() map[string][]int32 {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	assignments := make(map[string][]int32, len(c.assignments))
+	for topic, partitions := range c.assignments {
+		assignments[topic] = append([]int32(nil), partitions...)
+	}
+	return assignments
+}
+
+// rebalanced 记录分配结果并通知回调
+func (c *KafkaGroupConsumer) rebalanced(eventType string, session sarama.ConsumerGroupSession) {
+	event := KafkaRebalanceEvent{
+		Type:         eventType,
+		MemberId:     session.MemberID(),
+		GenerationId: session.GenerationID(),
+		Claims:       session.Claims(),
+	}
+	c.stateLock.Lock()
+	if eventType == KafkaPartitionsAssigned {
+		c.assignments = event.Claims
+	} else {
+		c.assignments = nil
+	}
+	c.stateLock.Unlock()
+
+	if c.logger != nil {
+		c.logger.InfoCtx(session.Context(), "kafka consumer group rebalanced",
+			zap.String("group", c.groupName),
+			zap.String("event", eventType),
+			zap.String("member_id", event.MemberId),
+			zap.Int32("generation_id", event.GenerationId),
+			zap.Any("claims", event.Claims),
+		)
+	}
+	c.lock.Lock()
+	handle := c.rebalanceHandle
+	c.lock.Unlock()
+	if handle != nil {
+		handle(event)
+	}
+}
+
+// Lag 查询消费组在所有订阅topic上的消费延迟，尚未创建的topic(如未用到的重试topic)被跳过
+func (c *KafkaGroupConsumer) Lag(ctx context.Context) ([]KafkaPartitionLag, error) {
+	admin, err := c.clusterAdmin()
+	if err != nil {
+		return nil, err
+	}
+
+	topicPartitions := make(map[string][]int32, len(c.topics))
+	for _, topic := range c.topics {
+		partitions, err := c.client.Partitions(topic)
+		if errors.Is(err, sarama.ErrUnknownTopicOrPartition) || (err == nil && len(partitions) == 0) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get partitions of %s: %w", topic, err)
+		}
+		topicPartitions[topic] = partitions
+	}
+	if len(topicPartitions) == 0 {
+		return nil, nil
+	}
+	offsets, err := admin.ListConsumerGroupOffsets(c.groupName, topicPartitions)
+	if err != nil {
+		return nil, fmt.Errorf("list offsets of group %s: %w", c.groupName, err)
+	}
+
+	assignments := c.Assignments()
+	var lags []KafkaPartitionLag
+	for topic, partitions := range topicPartitions {
+		assigned := make(map[int32]bool, len(assignments[topic]))
+		for _, partition := range assignments[topic] {
+			assigned[partition] = true
+		}
+		for _, partition := range partitions {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+			highWaterMark, err := c.client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, fmt.Errorf("get offset of %s/%d: %w", topic, partition, err)
+			}
+			lag := KafkaPartitionLag{
+				Topic:         topic,
+				Partition:     partition,
+				Committed:     -1,
+				HighWaterMark: highWaterMark,
+				Assigned:      assigned[partition],
+			}
+			if block := offsets.GetBlock(topic, partition); block != nil && block.Err == sarama.ErrNoError {
+				lag.Committed = block.Offset
+			}
+			if lag.Committed >= 0 {
+				lag.Lag = highWaterMark - lag.Committed
+			} else if oldest, err := c.client.GetOffset(topic, partition, sarama.OffsetOldest); err == nil {
+				// 未提交过位移时按最早的位移计算
+				lag.Lag = highWaterMark - oldest
+			}
+			lags = append(lags, lag)
+		}
+	}
+	return lags, nil
+}
+
+// clusterAdmin 首次查询延迟时创建，使用独立的连接，关闭时不影响消费，Close 后不再创建
+func (c *KafkaGroupConsumer) clusterAdmin() (sarama.ClusterAdmin, error) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	if c.closed {
+		return nil, errors.New("kafka consumer is closed")
+	}
+	if c.admin != nil {
+		return c.admin, nil
+	}
+	admin, err := sarama.NewClusterAdmin(c.brokerAddress, c.saramaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("new cluster admin: %w", err)
+	}
+	c.admin = admin
+	return admin, nil
+}
+
+// watchGroupErrors 消费组的非致命错误，如提交位移失败，交给 GroupErrHandleFunc 处理
+// ConsumeErrHandleFunc 只接收导致消费停止的错误
+func (c *KafkaGroupConsumer) watchGroupErrors() {
+	for err := range c.consumerGroup.Errors() {
+		if c.logger != nil {
+			c.logger.Error("kafka consumer group error", zap.String("group", c.groupName), zap.Error(err))
+		}
+		c.lock.Lock()
+		handle := c.groupErrHandle
+		c.lock.Unlock()
+		if handle != nil {
+			handle(err)
+		}
+	}
+}
+
+// watchLag 定期查询消费延迟并更新指标，消费者空闲或阻塞时指标仍能反映积压，ctx 结束或 Close 时停止
+func (c *KafkaGroupConsumer) watchLag(ctx context.Context) {
+	ticker := time.NewTicker(c.lagInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.closing:
+			return
+		case <-ticker.C:
+		}
+		lags, err := c.Lag(ctx)
+		if err != nil {
+			if c.logger != nil && ctx.Err() == nil {
+				c.logger.WarningCtx(ctx, "kafka consumer lag check failed", zap.String("group", c.groupName), zap.Error(err))
+			}
+			continue
+		}
+		if c.metrics != nil {
+			for _, lag := range lags {
+				c.metrics.SetKafkaLag(lag.Topic, lag.Partition, lag.Lag)
+			}
+		}
+	}
+}
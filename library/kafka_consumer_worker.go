@@ -0,0 +1,124 @@
+package library
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+const defaultKafkaWorkerQueueSize = 16
+
+// kafkaOffsetTracker 按分发顺序记录消息，只提交到最小的连续已完成位移，rebalance时未完成的消息会被重新消费
+type kafkaOffsetTracker struct {
+	session sarama.ConsumerGroupSession
+	lock    sync.Mutex
+	pending []*sarama.ConsumerMessage
+	done    map[int64]struct{}
+}
+
+func newKafkaOffsetTracker(session sarama.ConsumerGroupSession) *kafkaOffsetTracker {
+	return &kafkaOffsetTracker{session: session, done: make(map[int64]struct{})}
+}
+
+func (t *kafkaOffsetTracker) add(msg *sarama.ConsumerMessage) {
+	t.lock.Lock()
+	t.pending = append(t.pending, msg)
+	t.lock.Unlock()
+}
+
+func (t *kafkaOffsetTracker) complete(msg *sarama.ConsumerMessage) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.done[msg.Offset] = struct{}{}
+
+	var last *sarama.ConsumerMessage
+	for len(t.pending) > 0 {
+		if _, ok := t.done[t.pending[0].Offset]; !ok {
+			break
+		}
+		last = t.pending[0]
+		delete(t.done, last.Offset)
+		t.pending[0] = nil
+		t.pending = t.pending[1:]
+	}
+	if last != nil {
+		t.session.MarkMessage(last, "")
+	}
+}
+
+// consumeConcurrently 按key分发到多个worker，同一key的消息由同一worker顺序处理，无key的消息轮询分发
+func (h *GroupConsumerHandler) consumeConcurrently(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	queueSize := h.workerQueueSize
+	if queueSize <= 0 {
+		queueSize = defaultKafkaWorkerQueueSize
+	}
+	tracker := newKafkaOffsetTracker(session)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+
+	var wg sync.WaitGroup
+	queues := make([]chan *sarama.ConsumerMessage, h.workers)
+	for i := range queues {
+		queues[i] = make(chan *sarama.ConsumerMessage, queueSize)
+		wg.Add(1)
+		go func(queue chan *sarama.ConsumerMessage) {
+			defer wg.Done()
+			for msg := range queue {
+				// 已停止或rebalance时不再处理，未提交的消息之后重新消费
+				select {
+				case <-stop:
+					continue
+				case <-session.Context().Done():
+					continue
+				default:
+				}
+				if !h.consume(session, msg, tracker.complete) {
+					stopOnce.Do(func() { close(stop) })
+				}
+			}
+		}(queues[i])
+	}
+	// 等待处理中的消息完成并提交位移后再返回，避免rebalance后重复消费
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+	}()
+
+	roundRobin := 0
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if h.metrics != nil {
+				h.metrics.SetKafkaLag(msg.Topic, msg.Partition, claim.HighWaterMarkOffset()-msg.Offset-1)
+			}
+
+			var queue chan *sarama.ConsumerMessage
+			if len(msg.Key) == 0 {
+				queue = queues[roundRobin%len(queues)]
+				roundRobin++
+			} else {
+				hash := fnv.New32a()
+				_, _ = hash.Write(msg.Key)
+				queue = queues[hash.Sum32()%uint32(len(queues))]
+			}
+			tracker.add(msg)
+			select {
+			case queue <- msg:
+			case <-stop:
+				return drainKafkaClaim(session, claim)
+			case <-session.Context().Done():
+				return nil
+			}
+		case <-stop:
+			return drainKafkaClaim(session, claim)
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package library
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+// markRecordSession 记录提交的位移
+type markRecordSession struct {
+	sarama.ConsumerGroupSession
+
+	lock    sync.Mutex
+	offsets []int64
+}
+
+func (s *markRecordSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.lock.Lock()
+	s.offsets = append(s.offsets, msg.Offset)
+	s.lock.Unlock()
+}
+
+func (s *markRecordSession) marked() []int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]int64(nil), s.offsets...)
+}
+
+func TestKafkaOffsetTrackerOutOfOrder(t *testing.T) {
+	session := &markRecordSession{}
+	tracker := newKafkaOffsetTracker(session)
+
+	msgs := make([]*sarama.ConsumerMessage, 5)
+	for i := range msgs {
+		msgs[i] = &sarama.ConsumerMessage{Topic: "order", Partition: 0, Offset: int64(10 + i)}
+		tracker.add(msgs[i])
+	}
+
+	steps := []struct {
+		complete int
+		marked   []int64
+	}{
+		{complete: 2, marked: nil},             // 10、11未完成
+		{complete: 1, marked: nil},             // 10未完成
+		{complete: 0, marked: []int64{12}},     // 10~12连续完成
+		{complete: 4, marked: []int64{12}},     // 13未完成
+		{complete: 3, marked: []int64{12, 14}}, // 13~14连续完成
+	}
+	for _, step := range steps {
+		tracker.complete(msgs[step.complete])
+		if got := session.marked(); !reflect.DeepEqual(got, step.marked) {
+			t.Fatalf("complete offset %d: marked %v, want %v", msgs[step.complete].Offset, got, step.marked)
+		}
+	}
+	if len(tracker.pending) != 0 || len(tracker.done) != 0 {
+		t.Fatalf("tracker not drained: pending %d, done %d", len(tracker.pending), len(tracker.done))
+	}
+}
+
+func TestKafkaOffsetTrackerIncompleteNotMarked(t *testing.T) {
+	session := &markRecordSession{}
+	tracker := newKafkaOffsetTracker(session)
+
+	first := &sarama.ConsumerMessage{Offset: 1}
+	second := &sarama.ConsumerMessage{Offset: 2}
+	tracker.add(first)
+	tracker.add(second)
+
+	// 第一条消息一直未完成时不能提交后面的位移，rebalance后两条都会重新消费
+	tracker.complete(second)
+	if got := session.marked(); len(got) != 0 {
+		t.Fatalf("marked %v before offset 1 completed", got)
+	}
+}
@@ -0,0 +1,225 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+)
+
+// 回放时移除的消息头，回放后作为新消息重新计算重试
+var kafkaFailureHeaders = []string{
+	KafkaHeaderOriginalTopic,
+	KafkaHeaderOriginalPartition,
+	KafkaHeaderOriginalOffset,
+	KafkaHeaderError,
+	KafkaHeaderRetries,
+	KafkaHeaderRetryStage,
+	KafkaHeaderRetryAt,
+}
+
+// KafkaDeadLetterReplayConfig 死信回放脚本配置
+type KafkaDeadLetterReplayConfig struct {
+	Name          string             //名称（自定义）
+	Version       string             //版本
+	BrokerAddress []string           //消息代理服务器地址
+	GroupName     string             //记录回放进度的消费组，重复执行时从上次位置继续，默认 Name-dlq-replay
+	Producer      *KafkaSyncProducer //回放使用的producer，为nil时按broker配置创建
+	ExtraConfig   *sarama.Config     //额外配置项
+	Logger        *Log               //记录回放结果
+}
+
+// NewKafkaDeadLetterReplayCommand 死信回放脚本，通过 CliCommand.AddConfig 注册
+//
+//	kafka:dlq-replay --topic=order.DLQ [--target=order] [--limit=100]
+func NewKafkaDeadLetterReplayCommand(conf *KafkaDeadLetterReplayConfig) *CommandConfig {
+	return &CommandConfig{
+		Signature:   "kafka:dlq-replay {--topic=: 死信topic} {--target: 回放到的topic，默认为消息头中的原topic} {--limit=0: 最多回放条数，0不限制}",
+		Description: "将死信topic中的消息重新发送到原topic",
+		HandleFunc: func(ctx context.Context, cmd *ExecCommand) error {
+			options := cmd.Options()
+			topic, _ := options["topic"].(string)
+			target, _ := options["target"].(string)
+			limitOption, _ := options["limit"].(string)
+			limit, err := strconv.Atoi(strings.TrimSpace(limitOption))
+			if limitOption != "" && err != nil {
+				return fmt.Errorf("limit is not a number: %w", err)
+			}
+			_, err = ReplayKafkaDeadLetter(ctx, conf, topic, target, limit)
+			return err
+		},
+	}
+}
+
+// ReplayKafkaDeadLetter 将死信topic中执行时已存在的消息发送到 target，target 为空时发送到消息头中的原topic
+// 每条消息发送成功后记录位移，中途失败时下次从失败的消息继续，返回回放的消息数
+func ReplayKafkaDeadLetter(ctx context.Context, conf *KafkaDeadLetterReplayConfig, topic, target string, limit int) (replayed int, err error) {
+	if topic == "" {
+		return 0, fmt.Errorf("[%s] dead letter topic is empty", conf.Name)
+	}
+	extraConfig := conf.ExtraConfig
+	if extraConfig == nil {
+		extraConfig = sarama.NewConfig()
+	}
+	extraConfig.Version, err = sarama.ParseKafkaVersion(conf.Version)
+	if err != nil {
+		return 0, fmt.Errorf("[%s] version string is err: %w", conf.Name, err)
+	}
+	// 没有回放记录时从头开始
+	extraConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+	groupName := conf.GroupName
+	if groupName == "" {
+		groupName = conf.Name + "-dlq-replay"
+	}
+
+	client, err := sarama.NewClient(conf.BrokerAddress, extraConfig)
+	if err != nil {
+		return 0, fmt.Errorf("[%s] new client is error: %w", conf.Name, err)
+	}
+	defer client.Close()
+
+	producer := conf.Producer
+	if producer == nil {
+		producerConfig := sarama.NewConfig()
+		producerConfig.Net = extraConfig.Net
+		producer, err = NewKafkaSyncProducer(&KafkaProducerConfig{
+			Name:          conf.Name + "-dlq-replay",
+			Version:       conf.Version,
+			BrokerAddress: conf.BrokerAddress,
+			ExtraConfig:   producerConfig,
+		})
+		if err != nil {
+			return 0, err
+		}
+		defer producer.Close()
+	}
+
+	offsetManager, err := sarama.NewOffsetManagerFromClient(groupName, client)
+	if err != nil {
+		return 0, fmt.Errorf("[%s] new offset manager is error: %w", conf.Name, err)
+	}
+	defer offsetManager.Close()
+	defer offsetManager.Commit()
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return 0, fmt.Errorf("[%s] new consumer is error: %w", conf.Name, err)
+	}
+	defer consumer.Close()
+
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return 0, fmt.Errorf("[%s] get partitions of %s is error: %w", conf.Name, topic, err)
+	}
+	for _, partition := range partitions {
+		if limit > 0 && replayed >= limit {
+			break
+		}
+		count, e := replayKafkaPartition(ctx, client, consumer, offsetManager, producer, topic, partition, target, limit-replayed)
+		replayed += count
+		if e != nil {
+			err = fmt.Errorf("[%s] replay %s/%d is error: %w", conf.Name, topic, partition, e)
+			break
+		}
+	}
+
+	if conf.Logger != nil {
+		conf.Logger.InfoCtx(ctx, "kafka dead letter replayed",
+			zap.String("topic", topic),
+			zap.String("target", target),
+			zap.Int("replayed", replayed),
+			zap.Error(err),
+		)
+	}
+	return replayed, err
+}
+
+// replayKafkaPartition 回放单个分区，limit<=0 不限制
+func replayKafkaPartition(ctx context.Context, client sarama.Client, consumer sarama.Consumer, offsetManager sarama.OffsetManager, producer *KafkaSyncProducer, topic string, partition int32, target string, limit int) (replayed int, err error) {
+	highWaterMark, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, err
+	}
+	partitionOffsetManager, err := offsetManager.ManagePartition(topic, partition)
+	if err != nil {
+		return 0, err
+	}
+	defer partitionOffsetManager.Close()
+
+	// 未提交过位移时 NextOffset 返回 OffsetOldest/OffsetNewest，已提交的位移也可能因过期已被删除，都从最早的消息开始
+	oldestOffset, err := client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, err
+	}
+	nextOffset, _ := partitionOffsetManager.NextOffset()
+	if nextOffset < oldestOffset {
+		nextOffset = oldestOffset
+	}
+	if nextOffset >= highWaterMark {
+		return 0, nil
+	}
+	partitionConsumer, err := consumer.ConsumePartition(topic, partition, nextOffset)
+	if err != nil {
+		return 0, err
+	}
+	defer partitionConsumer.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return replayed, ctx.Err()
+		case msg, ok := <-partitionConsumer.Messages():
+			if !ok {
+				return replayed, nil
+			}
+			replayMsg, e := newKafkaReplayMessage(msg, target)
+			if e != nil {
+				return replayed, e
+			}
+			if _, _, e = producer.SendMessageCtx(ctx, replayMsg); e != nil {
+				return replayed, e
+			}
+			partitionOffsetManager.MarkOffset(msg.Offset+1, "")
+			replayed++
+			if msg.Offset+1 >= highWaterMark || (limit > 0 && replayed >= limit) {
+				return replayed, nil
+			}
+		}
+	}
+}
+
+func newKafkaReplayMessage(msg *sarama.ConsumerMessage, target string) (*sarama.ProducerMessage, error) {
+	if target == "" {
+		target = getKafkaHeader(msg.Headers, KafkaHeaderOriginalTopic)
+	}
+	if target == "" {
+		return nil, fmt.Errorf("message at offset %d has no %s header", msg.Offset, KafkaHeaderOriginalTopic)
+	}
+
+	replayMsg := &sarama.ProducerMessage{
+		Topic: target,
+		Value: sarama.ByteEncoder(msg.Value),
+	}
+	if msg.Key != nil {
+		replayMsg.Key = sarama.ByteEncoder(msg.Key)
+	}
+	for _, header := range msg.Headers {
+		if header == nil || isKafkaFailureHeader(string(header.Key)) {
+			continue
+		}
+		replayMsg.Headers = append(replayMsg.Headers, *header)
+	}
+	return replayMsg, nil
+}
+
+func isKafkaFailureHeader(key string) bool {
+	for _, failureHeader := range kafkaFailureHeaders {
+		if strings.EqualFold(key, failureHeader) {
+			return true
+		}
+	}
+	return false
+}
@@ -7,18 +7,44 @@ import (
 	"github.com/IBM/sarama"
 	"log"
 	"os"
+	"strings"
 	"sync"
+	"time"
 )
 
 type KafkaGroupConsumer struct {
 	consumerGroup       sarama.ConsumerGroup
+	client              sarama.Client
+	metrics             *Metrics
 	messageHandle       MessageHandleFun       // 自动确认消息，当手动方法不存在时才会使用
+	messageHandleCtx    MessageHandleCtxFun    // 自动确认消息，携带链路上下文，优先于 messageHandle
 	messageHandleByHand MessageHandleFunByHand // 手动确认消息
+	messageHandleBatch  MessageBatchHandleFun  // 批量处理，优先于单条处理
 	consumeErrHandle    ConsumeErrHandleFunc
+	failurePolicy       *kafkaFailurePolicy
+	failureProducer     *KafkaSyncProducer // 内部创建的重试、死信producer，关闭时一并关闭
 	setupHandle         SetupHandleFun
 	cleanupHandle       CleanupHandleFun
 	topics              []string
+	groupName           string
+	peer                string
+	workers             int
+	workerQueueSize     int
+	batchSize           int
+	batchWait           time.Duration
+	rebalanceHandle     RebalanceHandleFun
+	groupErrHandle      GroupErrHandleFunc
+	logger              *Log
+	lagInterval         time.Duration
+	brokerAddress       []string
+	saramaConfig        *sarama.Config
 	lock                sync.Mutex
+
+	stateLock   sync.RWMutex
+	assignments map[string][]int32
+	admin       sarama.ClusterAdmin
+	closed      bool
+	closing     chan struct{} // Close 时关闭，停止后台的延迟检查
 }
 
 func NewKafkaGroupConsumer(config *KafkaGroupConsumerConfig) (kafkaGroupConsumer *KafkaGroupConsumer, err error) {
@@ -49,19 +75,69 @@ func NewKafkaGroupConsumer(config *KafkaGroupConsumerConfig) (kafkaGroupConsumer
 		sarama.Logger = log.New(os.Stdout, "["+config.Name+"]", log.LstdFlags)
 	}
 
+	// 消费组的非致命错误通过 GroupErrHandleFunc 返回
+	config.ExtraConfig.Consumer.Return.Errors = true
+
 	if config.InitialOffset == sarama.OffsetOldest || config.InitialOffset == sarama.OffsetNewest {
 		config.ExtraConfig.Consumer.Offsets.Initial = config.InitialOffset
 	}
 
-	consumerGroup, err := sarama.NewConsumerGroup(config.BrokerAddress, config.GroupName, config.ExtraConfig)
+	failurePolicy, err := newKafkaFailurePolicy(config.Failure)
+	if err != nil {
+		err = fmt.Errorf("[%s] failure config is err: %w", config.Name, err)
+		return
+	}
+
+	client, err := sarama.NewClient(config.BrokerAddress, config.ExtraConfig)
 	if err != nil {
 		return nil, err
 	}
+	consumerGroup, err := sarama.NewConsumerGroupFromClient(config.GroupName, client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	var failureProducer *KafkaSyncProducer
+	if failurePolicy.producer == nil && failurePolicy.needProducer() {
+		producerConfig := sarama.NewConfig()
+		producerConfig.Net = config.ExtraConfig.Net
+		failureProducer, err = NewKafkaSyncProducer(&KafkaProducerConfig{
+			Name:          config.Name + "-failure",
+			Version:       config.Version,
+			BrokerAddress: config.BrokerAddress,
+			ExtraConfig:   producerConfig,
+			Metrics:       config.Metrics,
+		})
+		if err != nil {
+			_ = consumerGroup.Close()
+			_ = client.Close()
+			return nil, fmt.Errorf("[%s] new failure producer is err: %w", config.Name, err)
+		}
+		failurePolicy.producer = failureProducer
+	}
 
-	return &KafkaGroupConsumer{
-		consumerGroup: consumerGroup,
-		topics:        config.Topics,
-	}, nil
+	kafkaGroupConsumer = &KafkaGroupConsumer{
+		consumerGroup:   consumerGroup,
+		client:          client,
+		metrics:         config.Metrics,
+		failurePolicy:   failurePolicy,
+		failureProducer: failureProducer,
+		topics:          append(append([]string{}, config.Topics...), failurePolicy.retryTopics(config.Topics)...),
+		groupName:       config.GroupName,
+		peer:            strings.Join(config.BrokerAddress, ","),
+		workers:         config.Workers,
+		workerQueueSize: config.WorkerQueueSize,
+		batchSize:       config.BatchSize,
+		batchWait:       time.Duration(config.BatchWaitMillisecond) * time.Millisecond,
+		logger:          config.Logger,
+		lagInterval:     time.Duration(config.LagCheckSecond) * time.Second,
+		brokerAddress:   config.BrokerAddress,
+		saramaConfig:    config.ExtraConfig,
+		closing:         make(chan struct{}),
+	}
+	go kafkaGroupConsumer.watchGroupErrors()
+	return kafkaGroupConsumer, nil
 }
 
 func NewGroupConsumerHandler(handlerFun MessageHandleFun, handlerByHand MessageHandleFunByHand, setupHandle SetupHandleFun, cleanupHandle CleanupHandleFun) *GroupConsumerHandler {
@@ -74,7 +150,28 @@ func NewGroupConsumerHandler(handlerFun MessageHandleFun, handlerByHand MessageH
 }
 
 func (c *KafkaGroupConsumer) Close() error {
-	return c.consumerGroup.Close()
+	err := c.consumerGroup.Close()
+	if e := c.client.Close(); err == nil && e != sarama.ErrClosedClient {
+		err = e
+	}
+	if c.failureProducer != nil {
+		if e := c.failureProducer.Close(); err == nil {
+			err = e
+		}
+	}
+	c.stateLock.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.closing)
+	}
+	if c.admin != nil {
+		if e := c.admin.Close(); err == nil {
+			err = e
+		}
+		c.admin = nil
+	}
+	c.stateLock.Unlock()
+	return err
 }
 
 func (c *KafkaGroupConsumer) SetSetupHandleFunc(f SetupHandleFun) {
@@ -95,6 +192,20 @@ func (c *KafkaGroupConsumer) SetMessageHandleFunc(f MessageHandleFun) {
 	c.messageHandle = f
 }
 
+// SetMessageHandleCtxFunc ctx 中包含消息头还原的链路信息，消费关闭时取消，返回错误时按 Failure 配置处理
+func (c *KafkaGroupConsumer) SetMessageHandleCtxFunc(f MessageHandleCtxFun) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.messageHandleCtx = f
+}
+
+// SetMessageBatchHandleFunc 批量处理，部分失败时返回 KafkaBatchError，失败的消息按 Failure 配置处理
+func (c *KafkaGroupConsumer) SetMessageBatchHandleFunc(f MessageBatchHandleFun) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.messageHandleBatch = f
+}
+
 func (c *KafkaGroupConsumer) SetMessageHandleByHandFunc(f MessageHandleFunByHand) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -115,12 +226,27 @@ func (c *KafkaGroupConsumer) StartConsume(ctx context.Context) (err error) {
 		return
 	}
 
-	if c.messageHandle == nil {
+	if c.messageHandle == nil && c.messageHandleCtx == nil && c.messageHandleBatch == nil && c.messageHandleByHand == nil {
 		err = errors.New("请指定 MessageHandleFun 消息消费逻辑")
 		return
 	}
 
 	handler := NewGroupConsumerHandler(c.messageHandle, c.messageHandleByHand, c.setupHandle, c.cleanupHandle)
+	handler.handleMessageCtx = c.messageHandleCtx
+	handler.failurePolicy = c.failurePolicy
+	handler.handleConsumeErr = c.consumeErrHandle
+	handler.metrics = c.metrics
+	handler.groupName = c.groupName
+	handler.peer = c.peer
+	handler.workers = c.workers
+	handler.workerQueueSize = c.workerQueueSize
+	handler.handleMessageBatch = c.messageHandleBatch
+	handler.batchSize = c.batchSize
+	handler.batchWait = c.batchWait
+	handler.onRebalance = c.rebalanced
+	if c.lagInterval > 0 {
+		go c.watchLag(ctx)
+	}
 	go func() {
 		for {
 			if err := c.consumerGroup.Consume(ctx, c.topics, handler); err != nil {
@@ -139,6 +265,10 @@ type ConsumeErrHandleFunc func(error)
 
 type MessageHandleFun func(message *sarama.ConsumerMessage)
 
+type MessageHandleCtxFun func(ctx context.Context, message *sarama.ConsumerMessage) error
+
+type MessageBatchHandleFun func(ctx context.Context, messages []*sarama.ConsumerMessage) error
+
 type MessageHandleFunByHand func(session *sarama.ConsumerGroupSession, message *sarama.ConsumerMessage)
 
 type SetupHandleFun func(session *sarama.ConsumerGroupSession) error
@@ -147,12 +277,27 @@ type CleanupHandleFun func(session *sarama.ConsumerGroupSession) error
 
 type GroupConsumerHandler struct {
 	handleMessage       MessageHandleFun
+	handleMessageCtx    MessageHandleCtxFun
+	handleConsumeErr    ConsumeErrHandleFunc
+	failurePolicy       *kafkaFailurePolicy
 	handleMessageByHand MessageHandleFunByHand
 	handleSetup         SetupHandleFun
 	handleCleanup       CleanupHandleFun
+	metrics             *Metrics
+	groupName           string
+	peer                string
+	workers             int
+	workerQueueSize     int
+	handleMessageBatch  MessageBatchHandleFun
+	batchSize           int
+	batchWait           time.Duration
+	onRebalance         func(eventType string, session sarama.ConsumerGroupSession)
 }
 
 func (h *GroupConsumerHandler) Setup(session sarama.ConsumerGroupSession) error {
+	if h.onRebalance != nil {
+		h.onRebalance(KafkaPartitionsAssigned, session)
+	}
 	if h.handleSetup != nil {
 		return h.handleSetup(&session)
 	}
@@ -160,6 +305,9 @@ func (h *GroupConsumerHandler) Setup(session sarama.ConsumerGroupSession) error
 }
 
 func (h *GroupConsumerHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	if h.onRebalance != nil {
+		h.onRebalance(KafkaPartitionsRevoked, session)
+	}
 	if h.handleCleanup != nil {
 		return h.handleCleanup(&session)
 	}
@@ -167,22 +315,85 @@ func (h *GroupConsumerHandler) Cleanup(session sarama.ConsumerGroupSession) erro
 }
 
 func (h *GroupConsumerHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	if h.handleMessageByHand == nil && h.handleMessageBatch != nil {
+		return h.consumeBatch(session, claim)
+	}
+	if h.workers > 1 && h.handleMessageByHand == nil {
+		return h.consumeConcurrently(session, claim)
+	}
+
+	mark := func(msg *sarama.ConsumerMessage) {
+		session.MarkMessage(msg, "")
+	}
 	for {
 		select {
 		case msg, ok := <-claim.Messages():
 			if !ok {
 				return nil
 			}
-
-			if h.handleMessageByHand != nil {
-				h.handleMessageByHand(&session, msg)
-				break
+			if h.metrics != nil {
+				h.metrics.SetKafkaLag(msg.Topic, msg.Partition, claim.HighWaterMarkOffset()-msg.Offset-1)
+			}
+			if !h.consume(session, msg, mark) {
+				return drainKafkaClaim(session, claim)
 			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
 
-			h.handleMessage(msg)
-			session.MarkMessage(msg, "")
+// drainKafkaClaim 停止处理该分区，丢弃后续消息但保持 claim 直到 session 结束
+// ConsumeClaim 提前返回会结束整个 session 并立即rebalance，未提交位移的消息在下次rebalance后从失败位置重新消费
+func drainKafkaClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case _, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
 		case <-session.Context().Done():
 			return nil
 		}
 	}
 }
+
+// consume 每条消息创建一个entry span，手动确认 > 携带上下文 > 自动确认，处理完成后调用 mark，返回false时停止消费该分区
+func (h *GroupConsumerHandler) consume(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage, mark func(msg *sarama.ConsumerMessage)) bool {
+	ctx, span := startKafkaConsumerSpan(session.Context(), msg, h.groupName, h.peer)
+	var err error
+	switch {
+	case h.handleMessageByHand != nil:
+		h.handleMessageByHand(&session, msg)
+	case h.handleMessageCtx != nil:
+		policy := h.failurePolicy
+		if policy == nil {
+			policy = &kafkaFailurePolicy{action: KafkaFailureSkip}
+		}
+		origin := kafkaRetryOrigin(ctx, msg)
+		if origin == nil {
+			endKafkaSpan(span, nil)
+			return false
+		}
+		var commit bool
+		if commit, err = policy.handle(ctx, origin, h.handleMessageCtx); !commit {
+			endKafkaSpan(span, err)
+			if h.metrics != nil {
+				h.metrics.ObserveKafkaConsume(msg.Topic, err)
+			}
+			if session.Context().Err() == nil && h.handleConsumeErr != nil {
+				h.handleConsumeErr(fmt.Errorf("stop consuming %s/%d at offset %d: %w", msg.Topic, msg.Partition, msg.Offset, err))
+			}
+			return false
+		}
+		mark(msg)
+	default:
+		h.handleMessage(msg)
+		mark(msg)
+	}
+	endKafkaSpan(span, err)
+	if h.metrics != nil {
+		h.metrics.ObserveKafkaConsume(msg.Topic, err)
+	}
+	return true
+}
@@ -3,13 +3,34 @@ package library
 import "github.com/IBM/sarama"
 
 type KafkaGroupConsumerConfig struct {
-	Receiver      **KafkaGroupConsumer //实例接受对象
-	Name          string               //名称（自定义）
-	GroupName     string               //消费组名称
-	Version       string               //版本
-	Topics        []string             //消费主题
-	BrokerAddress []string             //消息代理服务器地址
-	ConsoleDebug  bool                 //开启终端debug模式
-	InitialOffset int64                //默认消费策略
-	ExtraConfig   *sarama.Config       //额外配置项
+	Receiver             **KafkaGroupConsumer //实例接受对象
+	Name                 string               //名称（自定义）
+	GroupName            string               //消费组名称
+	Version              string               //版本
+	Topics               []string             //消费主题
+	BrokerAddress        []string             //消息代理服务器地址
+	ConsoleDebug         bool                 //开启终端debug模式
+	InitialOffset        int64                //默认消费策略
+	ExtraConfig          *sarama.Config       //额外配置项
+	Metrics              *Metrics             //不为nil时记录消费数及消费延迟指标
+	Failure              *KafkaFailureConfig  //MessageHandleCtxFun、MessageBatchHandleFun 返回错误时的处理策略，默认跳过
+	Workers              int                  //每个分区的并发处理数，大于1时同一key的消息按顺序处理，手动确认模式不生效
+	WorkerQueueSize      int                  //每个worker的待处理消息数，默认16
+	BatchSize            int                  //批量处理时每批最大消息数，默认100
+	BatchWaitMillisecond int                  //批量处理时首条消息最长等待时间，默认1000ms
+	LagCheckSecond       int                  //大于0时定期查询各分区消费延迟并更新指标
+	Logger               *Log                 //记录rebalance、消费组错误
+}
+
+// KafkaFailureConfig MessageHandleCtxFun 返回错误时的处理策略，先本地重试，再依次转发到重试topic，都用尽后按 Action 处理
+type KafkaFailureConfig struct {
+	MaxRetries                int                  //本地重试次数，0不重试
+	InitialBackoffMillisecond int                  //首次重试等待时间，之后每次翻倍，默认100ms
+	MaxBackoffMillisecond     int                  //最大重试等待时间，默认10s
+	Retryable                 func(err error) bool //判断错误是否需要重试，为nil时都重试，不重试的错误跳过本地重试及重试topic，直接按 Action 处理
+	RetryDelaySeconds         []int                //重试topic的延迟，如 60,600,3600，topic名为 原topic.retry.60s，消费者自动订阅
+	Action                    string               //重试用尽后的处理：skip/dead_letter/stop_partition，默认skip
+	DeadLetterTopic           string               //死信topic，默认为 原topic.DLQ
+	Producer                  *KafkaSyncProducer   //发送重试、死信消息，为nil时按消费者的broker配置创建
+	Logger                    *Log                 //记录处理失败的消息
 }
@@ -1,14 +1,20 @@
 package library
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/IBM/sarama"
 	"log"
 	"os"
+	"strings"
 )
 
 type KafkaSyncProducer struct {
 	sarama.SyncProducer
+	client  sarama.Client
+	metrics *Metrics
+	peer    string
 }
 
 func NewKafkaSyncProducer(config *KafkaProducerConfig) (producer *KafkaSyncProducer, err error) {
@@ -36,19 +42,108 @@ func NewKafkaSyncProducer(config *KafkaProducerConfig) (producer *KafkaSyncProdu
 		return
 	}
 
-	syncProducer, e := sarama.NewSyncProducer(config.BrokerAddress, config.ExtraConfig)
+	client, e := sarama.NewClient(config.BrokerAddress, config.ExtraConfig)
 	if e != nil {
+		err = fmt.Errorf("[%s] new client is error: %w", config.Name, e)
+		return
+	}
+	syncProducer, e := sarama.NewSyncProducerFromClient(client)
+	if e != nil {
+		_ = client.Close()
 		err = fmt.Errorf("[%s] new sync producer is error: %w", config.Name, e)
 		return
 	}
 
 	producer = &KafkaSyncProducer{
-		syncProducer,
+		SyncProducer: syncProducer,
+		client:       client,
+		metrics:      config.Metrics,
+		peer:         strings.Join(config.BrokerAddress, ","),
 	}
 	return
 }
 
 func (producer *KafkaSyncProducer) Close() (err error) {
 	err = producer.SyncProducer.Close()
+	if e := producer.client.Close(); err == nil && e != sarama.ErrClosedClient {
+		err = e
+	}
+	return
+}
+
+// SendMessage 发送单条消息并记录发送指标，无上游链路时使用
+func (producer *KafkaSyncProducer) SendMessage(msg *sarama.ProducerMessage) (partition int32, offset int64, err error) {
+	return producer.SendMessageCtx(context.Background(), msg)
+}
+
+// SendMessageCtx 发送单条消息，链路信息及全局唯一标识写入消息头
+// ctx 超时或取消时立即返回，此时消息仍可能发送成功
+func (producer *KafkaSyncProducer) SendMessageCtx(ctx context.Context, msg *sarama.ProducerMessage) (partition int32, offset int64, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if ctx.Done() == nil {
+		return producer.sendSync(ctx, msg)
+	}
+
+	type sendResult struct {
+		partition int32
+		offset    int64
+		err       error
+	}
+	result := make(chan sendResult, 1)
+	go func() {
+		partition, offset, err := producer.sendSync(ctx, msg)
+		result <- sendResult{partition: partition, offset: offset, err: err}
+	}()
+	select {
+	case r := <-result:
+		return r.partition, r.offset, r.err
+	case <-ctx.Done():
+		return 0, 0, fmt.Errorf("send kafka message to %s: %w", msg.Topic, ctx.Err())
+	}
+}
+
+// sendSync 同步发送单条消息，创建span并记录发送指标，不受 ctx 取消影响
+func (producer *KafkaSyncProducer) sendSync(ctx context.Context, msg *sarama.ProducerMessage) (partition int32, offset int64, err error) {
+	span := startKafkaProducerSpan(ctx, msg, producer.peer)
+	partition, offset, err = producer.SyncProducer.SendMessage(msg)
+	endKafkaSpan(span, err)
+	if producer.metrics != nil {
+		producer.metrics.ObserveKafkaProduce(msg.Topic, err)
+	}
 	return
 }
+
+// SendMessages 批量发送消息并按消息记录发送指标，无上游链路时使用
+func (producer *KafkaSyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	return producer.SendMessagesCtx(context.Background(), msgs)
+}
+
+// SendMessagesCtx 批量发送消息，每条消息创建一个span
+func (producer *KafkaSyncProducer) SendMessagesCtx(ctx context.Context, msgs []*sarama.ProducerMessage) error {
+	spans := make([]SpanInterface, len(msgs))
+	for i, msg := range msgs {
+		spans[i] = startKafkaProducerSpan(ctx, msg, producer.peer)
+	}
+	err := producer.SyncProducer.SendMessages(msgs)
+
+	failed := make(map[*sarama.ProducerMessage]error)
+	var producerErrs sarama.ProducerErrors
+	if errors.As(err, &producerErrs) {
+		for _, producerErr := range producerErrs {
+			failed[producerErr.Msg] = producerErr.Err
+		}
+	}
+	for i, msg := range msgs {
+		msgErr, ok := failed[msg]
+		if !ok && err != nil && len(failed) == 0 {
+			msgErr = err
+		}
+		endKafkaSpan(spans[i], msgErr)
+		if producer.metrics != nil {
+			producer.metrics.ObserveKafkaProduce(msg.Topic, msgErr)
+		}
+	}
+	return err
+}
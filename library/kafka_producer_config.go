@@ -3,10 +3,25 @@ package library
 import "github.com/IBM/sarama"
 
 type KafkaProducerConfig struct {
-	Receiver      **KafkaSyncProducer //实例接受对象
-	Name          string              //连接名称(自定义)
-	Version       string              //版本
-	BrokerAddress []string            //消息代理服务器地址
-	ConsoleDebug  bool                //是否进入命令行终端debug模式
-	ExtraConfig   *sarama.Config      //额外的配置项
+	Receiver        **KafkaSyncProducer //实例接受对象
+	Name            string              //连接名称(自定义)
+	Version         string              //版本
+	BrokerAddress   []string            //消息代理服务器地址
+	ConsoleDebug    bool                //是否进入命令行终端debug模式
+	ExtraConfig     *sarama.Config      //额外的配置项
+	Metrics         *Metrics            //不为nil时记录发送指标
+	TransactionalId string              //事务id，NewKafkaTransactionProducer 必填，同一id同时只能有一个实例
+}
+
+type KafkaAsyncProducerConfig struct {
+	Receiver           **KafkaAsyncProducer                    //实例接受对象
+	Name               string                                  //连接名称(自定义)
+	Version            string                                  //版本
+	BrokerAddress      []string                                //消息代理服务器地址
+	ConsoleDebug       bool                                    //是否进入命令行终端debug模式
+	ExtraConfig        *sarama.Config                          //额外的配置项
+	Metrics            *Metrics                                //不为nil时记录发送指标
+	OnSuccess          func(msg *sarama.ProducerMessage)       //发送成功回调
+	OnError            func(producerErr *sarama.ProducerError) //发送失败回调，为nil时失败的消息只记录指标
+	CloseTimeoutSecond int                                     //关闭时等待缓冲中的消息发送完成的最长时间，默认10s
 }
@@ -0,0 +1,90 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"google.golang.org/protobuf/proto"
+)
+
+// 消息内容类型，写入 content-type 消息头
+const (
+	KafkaHeaderContentType = "content-type"
+	KafkaContentTypeJSON   = "application/json"
+	KafkaContentTypeProto  = "application/x-protobuf"
+)
+
+// KafkaSendOption 设置发送消息的key、消息头等
+type KafkaSendOption func(msg *sarama.ProducerMessage)
+
+// WithKafkaKey 相同key的消息发送到同一分区
+func WithKafkaKey(key string) KafkaSendOption {
+	return func(msg *sarama.ProducerMessage) {
+		msg.Key = sarama.StringEncoder(key)
+	}
+}
+
+func WithKafkaHeader(key, value string) KafkaSendOption {
+	return func(msg *sarama.ProducerMessage) {
+		setKafkaHeader(msg, key, value)
+	}
+}
+
+// WithKafkaTimestamp 消息时间，默认为发送时间
+func WithKafkaTimestamp(timestamp time.Time) KafkaSendOption {
+	return func(msg *sarama.ProducerMessage) {
+		msg.Timestamp = timestamp
+	}
+}
+
+func newKafkaMessage(topic string, value []byte, contentType string, opts []KafkaSendOption) *sarama.ProducerMessage {
+	msg := &sarama.ProducerMessage{
+		Topic:     topic,
+		Value:     sarama.ByteEncoder(value),
+		Timestamp: time.Now(),
+	}
+	setKafkaHeader(msg, KafkaHeaderContentType, contentType)
+	for _, opt := range opts {
+		opt(msg)
+	}
+	return msg
+}
+
+// NewKafkaJSONMessage 将 value 编码为json消息
+func NewKafkaJSONMessage(topic string, value interface{}, opts ...KafkaSendOption) (*sarama.ProducerMessage, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("marshal kafka message to %s: %w", topic, err)
+	}
+	return newKafkaMessage(topic, content, KafkaContentTypeJSON, opts), nil
+}
+
+// NewKafkaProtoMessage 将 value 编码为protobuf消息
+func NewKafkaProtoMessage(topic string, value proto.Message, opts ...KafkaSendOption) (*sarama.ProducerMessage, error) {
+	content, err := proto.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("marshal kafka message to %s: %w", topic, err)
+	}
+	return newKafkaMessage(topic, content, KafkaContentTypeProto, opts), nil
+}
+
+// SendJSON ctx 超时或取消时立即返回，此时消息仍可能发送成功
+func (producer *KafkaSyncProducer) SendJSON(ctx context.Context, topic string, value interface{}, opts ...KafkaSendOption) (partition int32, offset int64, err error) {
+	msg, err := NewKafkaJSONMessage(topic, value, opts...)
+	if err != nil {
+		return
+	}
+	return producer.SendMessageCtx(ctx, msg)
+}
+
+// SendProto ctx 超时或取消时立即返回，此时消息仍可能发送成功
+func (producer *KafkaSyncProducer) SendProto(ctx context.Context, topic string, value proto.Message, opts ...KafkaSendOption) (partition int32, offset int64, err error) {
+	msg, err := NewKafkaProtoMessage(topic, value, opts...)
+	if err != nil {
+		return
+	}
+	return producer.SendMessageCtx(ctx, msg)
+}
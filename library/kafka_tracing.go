@@ -0,0 +1,101 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"github.com/ctl5563096/base/contract"
+	"github.com/ctl5563096/base/helpers/str"
+)
+
+// 随消息透传的请求头，与 http 请求透传的一致
+var kafkaXeHeaders = []string{contract.TraceId, contract.XeTagHeader, contract.Sw8Header, contract.Sw8CorrelationHeader}
+
+func getKafkaHeader(headers []*sarama.RecordHeader, key string) string {
+	for _, header := range headers {
+		if header != nil && strings.EqualFold(string(header.Key), key) {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// setKafkaHeader 已存在同名header时覆盖
+func setKafkaHeader(msg *sarama.ProducerMessage, key, value string) {
+	for i, header := range msg.Headers {
+		if strings.EqualFold(string(header.Key), key) {
+			msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// startKafkaProducerSpan 将上下文中的全局唯一标识等写入消息头，并创建exit span注入链路信息
+func startKafkaProducerSpan(ctx context.Context, msg *sarama.ProducerMessage, peer string) SpanInterface {
+	if values, ok := ctx.Value(contract.XeCtx).(map[string]string); ok {
+		for _, key := range kafkaXeHeaders {
+			if value := values[key]; value != "" {
+				setKafkaHeader(msg, key, value)
+			}
+		}
+	}
+
+	tracer := GetGlobalTracer()
+	if tracer == nil {
+		return nil
+	}
+	span, _, err := tracer.StartExitSpan(ctx, fmt.Sprintf("Kafka/%s/Producer", msg.Topic), peer, SpanLayerMQ, func(key, value string) error {
+		setKafkaHeader(msg, key, value)
+		return nil
+	})
+	if err != nil {
+		return nil
+	}
+	span.SetComponent(contract.ComponentIDKafkaProducer)
+	span.Tag(TagMQBroker, peer)
+	span.Tag(TagMQTopic, msg.Topic)
+	return span
+}
+
+// startKafkaConsumerSpan 从消息头还原上下文，并创建entry span
+func startKafkaConsumerSpan(ctx context.Context, msg *sarama.ConsumerMessage, group, peer string) (context.Context, SpanInterface) {
+	values := make(map[string]string, len(kafkaXeHeaders))
+	for _, key := range kafkaXeHeaders {
+		values[key] = getKafkaHeader(msg.Headers, key)
+	}
+	if values[contract.TraceId] == "" {
+		values[contract.TraceId] = str.RandStringBytesMaskImprSrcUnsafe(16)
+	}
+	ctx = context.WithValue(ctx, contract.XeCtx, values)
+
+	tracer := GetGlobalTracer()
+	if tracer == nil {
+		return ctx, nil
+	}
+	span, spanCtx, err := tracer.StartEntrySpan(ctx, fmt.Sprintf("Kafka/%s/Consumer/%s", msg.Topic, group), SpanLayerMQ, func(key string) (string, error) {
+		return getKafkaHeader(msg.Headers, key), nil
+	})
+	if err != nil {
+		return ctx, nil
+	}
+	span.SetComponent(contract.ComponentIDKafkaConsumer)
+	span.Tag(TagMQBroker, peer)
+	span.Tag(TagMQTopic, msg.Topic)
+	span.Tag("mq.partition", strconv.Itoa(int(msg.Partition)))
+	span.Tag("mq.offset", strconv.FormatInt(msg.Offset, 10))
+	return spanCtx, span
+}
+
+func endKafkaSpan(span SpanInterface, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.Error(err)
+	}
+	span.End()
+}
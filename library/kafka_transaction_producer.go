@@ -0,0 +1,99 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"google.golang.org/protobuf/proto"
+)
+
+// KafkaTransactionProducer 事务producer，用于 读取-处理-写入 的精确一次处理
+// 下游消费者需设置 Consumer.IsolationLevel 为 sarama.ReadCommitted
+type KafkaTransactionProducer struct {
+	*KafkaSyncProducer
+	lock sync.Mutex
+}
+
+func NewKafkaTransactionProducer(config *KafkaProducerConfig) (*KafkaTransactionProducer, error) {
+	if config.TransactionalId == "" {
+		return nil, fmt.Errorf("[%s] transactionalId is empty", config.Name)
+	}
+	if config.ExtraConfig == nil {
+		config.ExtraConfig = sarama.NewConfig()
+	}
+	config.ExtraConfig.Producer.Idempotent = true
+	config.ExtraConfig.Producer.RequiredAcks = sarama.WaitForAll
+	config.ExtraConfig.Producer.Transaction.ID = config.TransactionalId
+	config.ExtraConfig.Net.MaxOpenRequests = 1
+
+	producer, err := NewKafkaSyncProducer(config)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaTransactionProducer{KafkaSyncProducer: producer}, nil
+}
+
+// KafkaTransaction 事务中发送消息
+// 发送是同步的，不因 ctx 取消提前返回，保证回滚或提交前事务中没有仍在发送的消息
+type KafkaTransaction struct {
+	ctx      context.Context
+	producer *KafkaSyncProducer
+}
+
+func (tx *KafkaTransaction) SendMessage(msg *sarama.ProducerMessage) error {
+	if err := tx.ctx.Err(); err != nil {
+		return err
+	}
+	_, _, err := tx.producer.sendSync(tx.ctx, msg)
+	return err
+}
+
+func (tx *KafkaTransaction) SendJSON(topic string, value interface{}, opts ...KafkaSendOption) error {
+	msg, err := NewKafkaJSONMessage(topic, value, opts...)
+	if err != nil {
+		return err
+	}
+	return tx.SendMessage(msg)
+}
+
+func (tx *KafkaTransaction) SendProto(topic string, value proto.Message, opts ...KafkaSendOption) error {
+	msg, err := NewKafkaProtoMessage(topic, value, opts...)
+	if err != nil {
+		return err
+	}
+	return tx.SendMessage(msg)
+}
+
+// RunInTransaction 在事务中执行 fn，fn 返回nil时提交，否则回滚
+// consumed 为本次处理的消费消息，其位移随事务一起提交到 groupId，实现精确一次处理
+func (p *KafkaTransactionProducer) RunInTransaction(ctx context.Context, groupId string, consumed []*sarama.ConsumerMessage, fn func(tx *KafkaTransaction) error) (err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if err = p.SyncProducer.BeginTxn(); err != nil {
+		return fmt.Errorf("begin kafka transaction: %w", err)
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if abortErr := p.SyncProducer.AbortTxn(); abortErr != nil {
+			err = fmt.Errorf("%w, abort kafka transaction: %v", err, abortErr)
+		}
+	}()
+
+	if err = fn(&KafkaTransaction{ctx: ctx, producer: p.KafkaSyncProducer}); err != nil {
+		return err
+	}
+	for _, msg := range consumed {
+		if err = p.SyncProducer.AddMessageToTxn(msg, groupId, nil); err != nil {
+			return fmt.Errorf("add consumed offset to kafka transaction: %w", err)
+		}
+	}
+	if err = p.SyncProducer.CommitTxn(); err != nil {
+		return fmt.Errorf("commit kafka transaction: %w", err)
+	}
+	return nil
+}
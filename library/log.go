@@ -37,6 +37,12 @@ func (log *Log) HttpRequestLog(record *contract.XiaoeHttpRequestRecord) {
 		zap.String("params", record.Params),
 		zap.String("response", record.Response),
 		zap.String("header", record.Header),
+		zap.Int("attempt", record.Attempt),
+		zap.Int("dns_cost", record.DnsCost),
+		zap.Int("connect_cost", record.ConnectCost),
+		zap.Int("tls_cost", record.TlsCost),
+		zap.Int("first_byte_cost", record.FirstByteCost),
+		zap.Bool("conn_reused", record.ConnReused),
 	)
 }
 
@@ -0,0 +1,201 @@
+package library
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	defaultMaxLabelValues = 200
+	metricsOtherLabel     = "other"
+)
+
+// Metrics prometheus 指标，各客户端通过配置中的 Metrics 字段接入
+type Metrics struct {
+	registry *prometheus.Registry
+	guard    *labelGuard
+
+	httpServerRequests *prometheus.CounterVec
+	httpServerDuration *prometheus.HistogramVec
+	httpClientRequests *prometheus.CounterVec
+	httpClientDuration *prometheus.HistogramVec
+	dbQueries          *prometheus.CounterVec
+	dbDuration         *prometheus.HistogramVec
+	redisCommands      *prometheus.CounterVec
+	redisDuration      *prometheus.HistogramVec
+	kafkaProduced      *prometheus.CounterVec
+	kafkaConsumed      *prometheus.CounterVec
+	kafkaLag           *prometheus.GaugeVec
+}
+
+func NewMetrics(conf *MetricsConfig) *Metrics {
+	buckets := conf.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	maxLabelValues := conf.MaxLabelValues
+	if maxLabelValues <= 0 {
+		maxLabelValues = defaultMaxLabelValues
+	}
+
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		guard:    newLabelGuard(maxLabelValues),
+	}
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		vec := prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: conf.Namespace, Name: name, Help: help, ConstLabels: conf.ConstLabels,
+		}, labels)
+		m.registry.MustRegister(vec)
+		return vec
+	}
+	histogram := func(name, help string, labels ...string) *prometheus.HistogramVec {
+		vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: conf.Namespace, Name: name, Help: help, ConstLabels: conf.ConstLabels, Buckets: buckets,
+		}, labels)
+		m.registry.MustRegister(vec)
+		return vec
+	}
+
+	m.httpServerRequests = counter("http_server_requests_total", "HTTP server requests.", "method", "route", "status")
+	m.httpServerDuration = histogram("http_server_request_duration_seconds", "HTTP server request latency.", "method", "route")
+	m.httpClientRequests = counter("http_client_requests_total", "HTTP client requests.", "host", "method", "status")
+	m.httpClientDuration = histogram("http_client_request_duration_seconds", "HTTP client request latency.", "host", "method")
+	m.dbQueries = counter("db_queries_total", "Database queries.", "db", "operation", "status")
+	m.dbDuration = histogram("db_query_duration_seconds", "Database query latency.", "db", "operation")
+	m.redisCommands = counter("redis_commands_total", "Redis commands.", "peer", "command", "status")
+	m.redisDuration = histogram("redis_command_duration_seconds", "Redis command latency.", "peer", "command")
+	m.kafkaProduced = counter("kafka_produced_messages_total", "Kafka produced messages.", "topic", "status")
+	m.kafkaConsumed = counter("kafka_consumed_messages_total", "Kafka consumed messages.", "topic", "status")
+	m.kafkaLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: conf.Namespace, Name: "kafka_consumer_lag", Help: "Kafka consumer lag in messages.", ConstLabels: conf.ConstLabels,
+	}, []string{"topic", "partition"})
+	m.registry.MustRegister(m.kafkaLag)
+
+	if !conf.DisableRuntime {
+		m.registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+	return m
+}
+
+// Registry 用于注册业务自定义指标
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler prometheus text 格式的指标输出
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDBStats 采集 sql.DB 连接池统计
+func (m *Metrics) RegisterDBStats(name string, db *sql.DB) error {
+	return m.registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+func (m *Metrics) ObserveHttpServer(method, route string, status int, cost time.Duration) {
+	route = m.guard.value("route", route)
+	m.httpServerRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.httpServerDuration.WithLabelValues(method, route).Observe(cost.Seconds())
+}
+
+// ObserveHttpClient status 为0表示未收到响应
+func (m *Metrics) ObserveHttpClient(host, method string, status int, cost time.Duration) {
+	host = m.guard.value("host", host)
+	statusLabel := "error"
+	if status > 0 {
+		statusLabel = strconv.Itoa(status)
+	}
+	m.httpClientRequests.WithLabelValues(host, method, statusLabel).Inc()
+	m.httpClientDuration.WithLabelValues(host, method).Observe(cost.Seconds())
+}
+
+func (m *Metrics) ObserveDB(db, operation string, err error, cost time.Duration) {
+	m.dbQueries.WithLabelValues(db, operation, errorStatus(err)).Inc()
+	m.dbDuration.WithLabelValues(db, operation).Observe(cost.Seconds())
+}
+
+func (m *Metrics) ObserveRedis(peer, command string, err error, cost time.Duration) {
+	command = m.guard.value("command", command)
+	m.redisCommands.WithLabelValues(peer, command, errorStatus(err)).Inc()
+	m.redisDuration.WithLabelValues(peer, command).Observe(cost.Seconds())
+}
+
+func (m *Metrics) ObserveKafkaProduce(topic string, err error) {
+	m.kafkaProduced.WithLabelValues(m.guard.value("topic", topic), errorStatus(err)).Inc()
+}
+
+func (m *Metrics) ObserveKafkaConsume(topic string, err error) {
+	m.kafkaConsumed.WithLabelValues(m.guard.value("topic", topic), errorStatus(err)).Inc()
+}
+
+func (m *Metrics) SetKafkaLag(topic string, partition int32, lag int64) {
+	m.kafkaLag.WithLabelValues(m.guard.value("topic", topic), strconv.Itoa(int(partition))).Set(float64(lag))
+}
+
+func errorStatus(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// labelGuard 限制标签取值个数，避免 url、host 等取值过多导致指标膨胀
+type labelGuard struct {
+	max    int
+	lock   sync.RWMutex
+	values map[string]map[string]struct{}
+}
+
+func newLabelGuard(max int) *labelGuard {
+	return &labelGuard{max: max, values: make(map[string]map[string]struct{})}
+}
+
+func (g *labelGuard) value(label, value string) string {
+	g.lock.RLock()
+	_, ok := g.values[label][value]
+	g.lock.RUnlock()
+	if ok {
+		return value
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	seen, ok := g.values[label]
+	if !ok {
+		seen = make(map[string]struct{})
+		g.values[label] = seen
+	}
+	if _, ok = seen[value]; ok {
+		return value
+	}
+	if len(seen) >= g.max {
+		return metricsOtherLabel
+	}
+	seen[value] = struct{}{}
+	return value
+}
+
+// metricsInterceptor 按目标host记录每次尝试的请求数及耗时
+func (c *HttpClient) metricsInterceptor(next HttpRoundTripFunc) HttpRoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if c.metrics == nil {
+			return next(req)
+		}
+		beginTime := time.Now()
+		resp, err := next(req)
+		status := 0
+		if err == nil && resp != nil {
+			status = resp.StatusCode
+		}
+		c.metrics.ObserveHttpClient(req.URL.Host, req.Method, status, time.Since(beginTime))
+		return resp, err
+	}
+}
@@ -0,0 +1,9 @@
+package library
+
+type MetricsConfig struct {
+	Namespace      string            // 指标名前缀，如 user_center
+	ConstLabels    map[string]string // 所有指标附加的固定标签，如 service、env
+	Buckets        []float64         // 耗时直方图分桶(秒)，默认 prometheus.DefBuckets
+	MaxLabelValues int               // 单个标签最多记录的不同取值，超出后记为 other，默认200
+	DisableRuntime bool              // 不采集 go runtime 及进程指标
+}
@@ -14,4 +14,5 @@ type MysqlConfig struct {
 	MaxLifeTime    int
 	MaxOpenConn    int
 	MaxIdleConn    int
+	Metrics        *Metrics //不为nil时记录连接池指标
 }
@@ -21,6 +21,9 @@ func NewRedisClient(ctx context.Context, conf *RedisConfig) (*RedisClient, error
 	if conf.EnableSkyWalking {
 		cli.AddHook(SkyWalkingRedisHook{Peer: addr})
 	}
+	if conf.Metrics != nil {
+		cli.AddHook(MetricsRedisHook{Peer: addr, Metrics: conf.Metrics})
+	}
 
 	if _, err := cli.Ping(ctx).Result(); err != nil {
 		err = fmt.Errorf("redis client:[%s] error:%w", conf.ConnectionName, err)
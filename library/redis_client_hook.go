@@ -7,9 +7,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/SkyAPM/go2sky"
 	"github.com/ctl5563096/base/contract"
-	agentv3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
 )
 
 // skyWalking接入hook
@@ -27,11 +25,11 @@ func (s SkyWalkingRedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder)
 
 func (s SkyWalkingRedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
 	var (
-		span go2sky.Span
+		span SpanInterface
 		ok   bool
 	)
 	val := ctx.Value(contract.Sw8Span)
-	if span, ok = val.(go2sky.Span); !ok {
+	if span, ok = val.(SpanInterface); !ok {
 		return nil
 	}
 
@@ -57,11 +55,11 @@ func (s SkyWalkingRedisHook) BeforeProcessPipeline(ctx context.Context, cmds []r
 
 func (s SkyWalkingRedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
 	var (
-		span go2sky.Span
+		span SpanInterface
 		ok   bool
 	)
 	val := ctx.Value(contract.Sw8Span)
-	if span, ok = val.(go2sky.Span); !ok {
+	if span, ok = val.(SpanInterface); !ok {
 		return nil
 	}
 
@@ -75,13 +73,13 @@ func (s SkyWalkingRedisHook) AfterProcessPipeline(ctx context.Context, cmds []re
 	return nil
 }
 
-func (s SkyWalkingRedisHook) CreateSpan(ctx context.Context, fullName, args interface{}) (go2sky.Span, error) {
-	tracker := go2sky.GetGlobalTracer()
+func (s SkyWalkingRedisHook) CreateSpan(ctx context.Context, fullName, args interface{}) (SpanInterface, error) {
+	tracker := GetGlobalTracer()
 	if tracker == nil {
 		return nil, nil
 	}
 
-	span, errT := tracker.CreateExitSpan(ctx, "redis", s.Peer, func(key, value string) error {
+	span, _, errT := tracker.StartExitSpan(ctx, "redis", s.Peer, SpanLayerCache, func(key, value string) error {
 		return nil
 	})
 	if errT != nil {
@@ -90,20 +88,19 @@ func (s SkyWalkingRedisHook) CreateSpan(ctx context.Context, fullName, args inte
 
 	span.SetComponent(contract.ComponentIDGoRedis)
 	span.SetOperationName(fmt.Sprintf("%s->%v", getFuncName(5), fullName))
-	span.SetSpanLayer(agentv3.SpanLayer_Cache)
-	span.Tag(go2sky.TagDBType, "redis")
-	span.Tag(go2sky.TagDBStatement, fmt.Sprintf("%s", args))
+	span.Tag(TagDBType, "redis")
+	span.Tag(TagDBStatement, fmt.Sprintf("%s", args))
 	return span, nil
 }
 
-func (s SkyWalkingRedisHook) EndSpan(span *go2sky.Span, errs ...error) {
+func (s SkyWalkingRedisHook) EndSpan(span *SpanInterface, errs ...error) {
 	if span == nil {
 		return
 	}
 
 	for _, err := range errs {
 		if err != nil {
-			(*span).Error(time.Now(), err.Error())
+			(*span).Error(err)
 		}
 	}
 	(*span).End()
@@ -118,3 +115,44 @@ func getFuncName(skip int) string {
 
 	return runtime.FuncForPC(pc).Name()
 }
+
+type redisMetricsBeginKey struct{}
+
+// MetricsRedisHook 记录 redis 命令数及耗时
+type MetricsRedisHook struct {
+	Peer    string // redis地址
+	Metrics *Metrics
+}
+
+func (h MetricsRedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisMetricsBeginKey{}, time.Now()), nil
+}
+
+func (h MetricsRedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if beginTime, ok := ctx.Value(redisMetricsBeginKey{}).(time.Time); ok {
+		err := cmd.Err()
+		if err == redis.Nil {
+			err = nil
+		}
+		h.Metrics.ObserveRedis(h.Peer, cmd.Name(), err, time.Since(beginTime))
+	}
+	return nil
+}
+
+func (h MetricsRedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisMetricsBeginKey{}, time.Now()), nil
+}
+
+func (h MetricsRedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if beginTime, ok := ctx.Value(redisMetricsBeginKey{}).(time.Time); ok {
+		var err error
+		for _, cmd := range cmds {
+			if cmd.Err() != nil && cmd.Err() != redis.Nil {
+				err = cmd.Err()
+				break
+			}
+		}
+		h.Metrics.ObserveRedis(h.Peer, "pipeline", err, time.Since(beginTime))
+	}
+	return nil
+}
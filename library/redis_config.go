@@ -9,4 +9,5 @@ type RedisConfig struct {
     DB               int
     PoolSize         int    // 连接池大小
     EnableSkyWalking bool   // 开启skyWalking追踪
+    Metrics          *Metrics // 不为nil时记录命令执行指标
 }
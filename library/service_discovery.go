@@ -0,0 +1,218 @@
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ServiceInstance 服务的一个实例
+type ServiceInstance struct {
+	Addr   string `json:"addr"`   // host:port
+	Weight int    `json:"weight"` // 权重，<=0 时视为1
+}
+
+// ServiceDiscoveryInterface 根据逻辑服务名获取实例列表
+type ServiceDiscoveryInterface interface {
+	Instances(ctx context.Context, service string) ([]ServiceInstance, error)
+}
+
+// StaticDiscovery 静态服务列表
+type StaticDiscovery struct {
+	lock     sync.RWMutex
+	services map[string][]ServiceInstance
+}
+
+func NewStaticDiscovery(services map[string][]ServiceInstance) *StaticDiscovery {
+	d := &StaticDiscovery{}
+	d.Update(services)
+	return d
+}
+
+// NewStaticDiscoveryFromEnv 从配置文件读取服务列表，每个实例格式为 host:port 或 host:port@weight
+//
+//	[services]
+//	user-center = ["10.0.0.1:8080@2", "10.0.0.2:8080"]
+func NewStaticDiscoveryFromEnv(env *Env, key string) (*StaticDiscovery, error) {
+	services := make(map[string][]ServiceInstance)
+	for service, addrs := range env.GetStringMapStringSlice(key) {
+		for _, addr := range addrs {
+			instance, err := parseServiceInstance(addr)
+			if err != nil {
+				return nil, fmt.Errorf("service discovery [%s] %w", service, err)
+			}
+			services[service] = append(services[service], instance)
+		}
+	}
+	return NewStaticDiscovery(services), nil
+}
+
+func parseServiceInstance(value string) (instance ServiceInstance, err error) {
+	value = strings.TrimSpace(value)
+	instance.Addr = value
+	instance.Weight = 1
+	if i := strings.LastIndex(value, "@"); i >= 0 {
+		instance.Addr = value[:i]
+		if instance.Weight, err = strconv.Atoi(value[i+1:]); err != nil {
+			return instance, fmt.Errorf("invalid instance weight %q: %w", value, err)
+		}
+	}
+	if _, _, err = net.SplitHostPort(instance.Addr); err != nil {
+		return instance, fmt.Errorf("invalid instance addr %q: %w", value, err)
+	}
+	return instance, nil
+}
+
+// Update 整体替换服务列表
+func (d *StaticDiscovery) Update(services map[string][]ServiceInstance) {
+	copied := make(map[string][]ServiceInstance, len(services))
+	for service, instances := range services {
+		copied[service] = append([]ServiceInstance{}, instances...)
+	}
+	d.lock.Lock()
+	d.services = copied
+	d.lock.Unlock()
+}
+
+func (d *StaticDiscovery) Instances(ctx context.Context, service string) ([]ServiceInstance, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	instances, ok := d.services[service]
+	if !ok || len(instances) == 0 {
+		return nil, fmt.Errorf("service %s has no instance", service)
+	}
+	return instances, nil
+}
+
+// DnsSrvDiscovery 通过 DNS SRV 记录发现服务，服务名即 SRV 查询名
+// 例如 _http._tcp.user-center.default.svc.cluster.local
+type DnsSrvDiscovery struct {
+	resolver  net.Resolver
+	cacheTime time.Duration
+	cacheMap  *LocalCache
+	logger    *zap.Logger
+}
+
+func NewDnsSrvDiscovery(cacheNums int, cacheTime time.Duration, logger *zap.Logger) *DnsSrvDiscovery {
+	return &DnsSrvDiscovery{
+		cacheTime: cacheTime,
+		cacheMap:  NewLocalCache(cacheNums),
+		logger:    logger,
+	}
+}
+
+func (d *DnsSrvDiscovery) Instances(ctx context.Context, service string) ([]ServiceInstance, error) {
+	if val, ok := d.cacheMap.Get(service); ok {
+		return val.([]ServiceInstance), nil
+	}
+
+	_, records, err := d.resolver.LookupSRV(ctx, "", "", service)
+	if d.logger != nil {
+		d.logger.Info("LookupSRV: records",
+			zap.String("service", service),
+			zap.Int("records", len(records)),
+			zap.Error(err))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]ServiceInstance, 0, len(records))
+	for _, record := range records {
+		instances = append(instances, ServiceInstance{
+			Addr:   net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))),
+			Weight: int(record.Weight),
+		})
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("service %s has no instance", service)
+	}
+	if d.cacheTime > 0 {
+		_ = d.cacheMap.Put(service, instances, d.cacheTime)
+	}
+	return instances, nil
+}
+
+// FileDiscovery 从json文件读取服务列表，按间隔检查文件修改时间并重新加载
+//
+//	{"user-center": [{"addr": "10.0.0.1:8080", "weight": 2}]}
+type FileDiscovery struct {
+	*StaticDiscovery
+	path     string
+	modTime  time.Time
+	logger   *zap.Logger
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+func NewFileDiscovery(path string, interval time.Duration, logger *zap.Logger) (*FileDiscovery, error) {
+	d := &FileDiscovery{
+		StaticDiscovery: NewStaticDiscovery(nil),
+		path:            path,
+		logger:          logger,
+		stopChan:        make(chan struct{}),
+	}
+	if err := d.reload(); err != nil {
+		return nil, err
+	}
+
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	go d.watch(interval)
+	return d, nil
+}
+
+func (d *FileDiscovery) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stopChan:
+			return
+		case <-ticker.C:
+			if err := d.reload(); err != nil && d.logger != nil {
+				d.logger.Error("FileDiscovery reload failed",
+					zap.String("path", d.path),
+					zap.Error(err))
+			}
+		}
+	}
+}
+
+func (d *FileDiscovery) reload() error {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return err
+	}
+	if !info.ModTime().After(d.modTime) {
+		return nil
+	}
+
+	content, err := os.ReadFile(d.path)
+	if err != nil {
+		return err
+	}
+	services := make(map[string][]ServiceInstance)
+	if err = json.Unmarshal(content, &services); err != nil {
+		return fmt.Errorf("parse service file %s: %w", d.path, err)
+	}
+	d.Update(services)
+	d.modTime = info.ModTime()
+	return nil
+}
+
+func (d *FileDiscovery) Close() error {
+	d.stopOnce.Do(func() {
+		close(d.stopChan)
+	})
+	return nil
+}
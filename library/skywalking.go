@@ -1,45 +1,81 @@
 package library
 
 import (
-    "fmt"
+	"fmt"
 
-    "github.com/SkyAPM/go2sky"
-    "github.com/SkyAPM/go2sky/reporter"
+	"github.com/SkyAPM/go2sky"
+	"github.com/SkyAPM/go2sky/reporter"
 )
 
 type SkyWalking struct {
-    *go2sky.Tracer
+	*go2sky.Tracer
+	reporter go2sky.Reporter
 }
 
 func NewSkyWalkingTracker(conf *SkyWalkingConfig) (sky *SkyWalking, err error) {
-    // 创建reporter
-    gRPCReporter, err2 := reporter.NewGRPCReporter(conf.Addr, conf.ReportOpts...)
-    if err2 != nil {
-        err = fmt.Errorf("创建上传gRpcReporter失败:%w", err2)
-        return
-    }
-
-    // 创建tracer
-    var tracerOpts []go2sky.TracerOption
-    tracerOpts = append(tracerOpts, go2sky.WithReporter(gRPCReporter), go2sky.WithSampler(conf.Sample))
-    tracerOpts = append(tracerOpts, conf.TracerOpts...)
-    tracer, err2 := go2sky.NewTracer(conf.ServiceName, tracerOpts...)
-    if err2 != nil {
-        err = fmt.Errorf("创建 tracer 失败:%w", err2)
-        return
-    }
-
-    sky = &SkyWalking{
-        tracer,
-    }
-
-    return
+	// 创建reporter
+	skyReporter, err2 := newSkyWalkingReporter(conf)
+	if err2 != nil {
+		err = err2
+		return
+	}
+
+	// 创建tracer
+	var tracerOpts []go2sky.TracerOption
+	tracerOpts = append(tracerOpts, go2sky.WithReporter(skyReporter), go2sky.WithSampler(conf.Sample))
+	tracerOpts = append(tracerOpts, conf.TracerOpts...)
+	tracer, err2 := go2sky.NewTracer(conf.ServiceName, tracerOpts...)
+	if err2 != nil {
+		err = fmt.Errorf("创建 tracer 失败:%w", err2)
+		return
+	}
+
+	sky = &SkyWalking{
+		Tracer:   tracer,
+		reporter: skyReporter,
+	}
+
+	return
+}
+
+func newSkyWalkingReporter(conf *SkyWalkingConfig) (go2sky.Reporter, error) {
+	switch conf.Reporter {
+	case "", SkyWalkingReporterGRPC:
+		gRPCReporter, err := reporter.NewGRPCReporter(conf.Addr, conf.ReportOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("创建上传gRpcReporter失败:%w", err)
+		}
+		return gRPCReporter, nil
+	case SkyWalkingReporterLog:
+		if conf.Logger == nil {
+			return nil, fmt.Errorf("skywalking log reporter requires Logger")
+		}
+		return NewSkyWalkingLogReporter(conf.Logger), nil
+	case SkyWalkingReporterMemory:
+		return NewSkyWalkingMemoryReporter(), nil
+	case SkyWalkingReporterNone:
+		return skyWalkingNoopReporter{}, nil
+	}
+	return nil, fmt.Errorf("unsupported skywalking reporter %s", conf.Reporter)
+}
+
+// MemoryReporter Reporter 为 memory 时返回内存reporter，否则返回nil
+func (sky *SkyWalking) MemoryReporter() *SkyWalkingMemoryReporter {
+	memory, _ := sky.reporter.(*SkyWalkingMemoryReporter)
+	return memory
+}
+
+// Close 关闭reporter，grpc reporter 会先上报缓冲中的span
+func (sky *SkyWalking) Close() {
+	if sky.reporter != nil {
+		sky.reporter.Close()
+	}
 }
 
 func (sky *SkyWalking) SwitchTrace(isTrace bool) {
-    if isTrace{
-        go2sky.SetGlobalTracer(sky.Tracer)
-        return
-    }
-    go2sky.SetGlobalTracer(nil)
+	if isTrace {
+		go2sky.SetGlobalTracer(sky.Tracer)
+		return
+	}
+	go2sky.SetGlobalTracer(nil)
 }
@@ -1,16 +1,18 @@
 package library
 
 import (
-    "github.com/SkyAPM/go2sky"
-    "github.com/SkyAPM/go2sky/reporter"
+	"github.com/SkyAPM/go2sky"
+	"github.com/SkyAPM/go2sky/reporter"
 )
 
 type SkyWalkingConfig struct {
-    Receiver    **SkyWalking
-    ServiceName string  // 当前服务名
-    Addr        string  // 上报地址
-    Sample      float64 // 采样率s
+	Receiver    **SkyWalking
+	ServiceName string  // 当前服务名
+	Addr        string  // 上报地址
+	Sample      float64 // 采样率s
+	Reporter    string  // grpc/log/memory/none，默认grpc
+	Logger      *Log    // Reporter 为 log 时写入的日志
 
-    ReportOpts []reporter.GRPCReporterOption
-    TracerOpts []go2sky.TracerOption
+	ReportOpts []reporter.GRPCReporterOption
+	TracerOpts []go2sky.TracerOption
 }
@@ -0,0 +1,226 @@
+package library
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SkyAPM/go2sky"
+	"go.uber.org/zap"
+)
+
+// SkyWalking reporter 类型
+const (
+	SkyWalkingReporterGRPC   = "grpc"   // 上报到 OAP
+	SkyWalkingReporterLog    = "log"    // 以json写入日志，用于本地开发
+	SkyWalkingReporterMemory = "memory" // 保存在内存中，用于单元测试断言
+	SkyWalkingReporterNone   = "none"   // 丢弃
+)
+
+// SkyWalkingSpan 上报的span，log/memory reporter 使用
+type SkyWalkingSpan struct {
+	TraceId         string              `json:"trace_id"`
+	SegmentId       string              `json:"segment_id"`
+	SpanId          int32               `json:"span_id"`
+	ParentSpanId    int32               `json:"parent_span_id"` // 同一segment内的父span，根span为-1
+	RefSegmentId    string              `json:"ref_segment_id,omitempty"`
+	RefSpanId       int32               `json:"ref_span_id,omitempty"` // 跨goroutine、跨进程时的父span
+	OperationName   string              `json:"operation_name"`
+	Peer            string              `json:"peer,omitempty"`
+	SpanType        string              `json:"span_type"` // Entry/Exit/Local
+	SpanLayer       string              `json:"span_layer"`
+	ComponentId     int32               `json:"component_id"`
+	IsError         bool                `json:"is_error"`
+	Tags            map[string]string   `json:"tags,omitempty"`
+	Logs            []map[string]string `json:"logs,omitempty"`
+	StartTime       int64               `json:"start_time"` // 毫秒时间戳
+	EndTime         int64               `json:"end_time"`
+	ServiceName     string              `json:"service_name"`
+	ServiceInstance string              `json:"service_instance"`
+}
+
+func newSkyWalkingSpan(service, instance string, span go2sky.ReportedSpan) SkyWalkingSpan {
+	segment := span.Context()
+	recorded := SkyWalkingSpan{
+		TraceId:         segment.TraceID,
+		SegmentId:       segment.SegmentID,
+		SpanId:          segment.SpanID,
+		ParentSpanId:    segment.ParentSpanID,
+		OperationName:   span.OperationName(),
+		Peer:            span.Peer(),
+		SpanType:        span.SpanType().String(),
+		SpanLayer:       span.SpanLayer().String(),
+		ComponentId:     span.ComponentID(),
+		IsError:         span.IsError(),
+		Tags:            make(map[string]string),
+		StartTime:       span.StartTime(),
+		EndTime:         span.EndTime(),
+		ServiceName:     service,
+		ServiceInstance: instance,
+	}
+	if refs := span.Refs(); len(refs) > 0 && refs[0] != nil {
+		recorded.RefSegmentId = refs[0].ParentSegmentID
+		recorded.RefSpanId = refs[0].ParentSpanID
+	}
+	for _, tag := range span.Tags() {
+		recorded.Tags[tag.Key] = tag.Value
+	}
+	for _, log := range span.Logs() {
+		data := make(map[string]string, len(log.Data))
+		for _, kv := range log.Data {
+			data[kv.Key] = kv.Value
+		}
+		recorded.Logs = append(recorded.Logs, data)
+	}
+	return recorded
+}
+
+// SkyWalkingLogReporter 将span以json写入日志
+type SkyWalkingLogReporter struct {
+	logger   *Log
+	service  string
+	instance string
+}
+
+func NewSkyWalkingLogReporter(logger *Log) *SkyWalkingLogReporter {
+	return &SkyWalkingLogReporter{logger: logger}
+}
+
+func (r *SkyWalkingLogReporter) Boot(service string, serviceInstance string, cdsWatchers []go2sky.AgentConfigChangeWatcher) {
+	r.service = service
+	r.instance = serviceInstance
+}
+
+func (r *SkyWalkingLogReporter) Send(spans []go2sky.ReportedSpan) {
+	for _, span := range spans {
+		r.logger.Info("skywalking span", zap.Any("span", newSkyWalkingSpan(r.service, r.instance, span)))
+	}
+}
+
+func (r *SkyWalkingLogReporter) Close() {
+	_ = r.logger.Sync()
+}
+
+// SkyWalkingMemoryReporter 在内存中保存span，供单元测试查询span树
+type SkyWalkingMemoryReporter struct {
+	service  string
+	instance string
+
+	lock   sync.Mutex
+	cond   *sync.Cond
+	spans  []SkyWalkingSpan
+	closed bool
+}
+
+func NewSkyWalkingMemoryReporter() *SkyWalkingMemoryReporter {
+	r := &SkyWalkingMemoryReporter{}
+	r.cond = sync.NewCond(&r.lock)
+	return r
+}
+
+func (r *SkyWalkingMemoryReporter) Boot(service string, serviceInstance string, cdsWatchers []go2sky.AgentConfigChangeWatcher) {
+	r.lock.Lock()
+	r.service = service
+	r.instance = serviceInstance
+	r.lock.Unlock()
+}
+
+func (r *SkyWalkingMemoryReporter) Send(spans []go2sky.ReportedSpan) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return
+	}
+	for _, span := range spans {
+		r.spans = append(r.spans, newSkyWalkingSpan(r.service, r.instance, span))
+	}
+	r.cond.Broadcast()
+}
+
+func (r *SkyWalkingMemoryReporter) Close() {
+	r.lock.Lock()
+	r.closed = true
+	r.lock.Unlock()
+	r.cond.Broadcast()
+}
+
+// Spans 按上报顺序返回所有span
+func (r *SkyWalkingMemoryReporter) Spans() []SkyWalkingSpan {
+	return r.Filter(func(span SkyWalkingSpan) bool { return true })
+}
+
+// Filter 返回满足条件的span
+func (r *SkyWalkingMemoryReporter) Filter(match func(span SkyWalkingSpan) bool) []SkyWalkingSpan {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var spans []SkyWalkingSpan
+	for _, span := range r.spans {
+		if match(span) {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// FindByOperation 按操作名查询
+func (r *SkyWalkingMemoryReporter) FindByOperation(operation string) []SkyWalkingSpan {
+	return r.Filter(func(span SkyWalkingSpan) bool { return span.OperationName == operation })
+}
+
+// Trace 返回同一链路的span
+func (r *SkyWalkingMemoryReporter) Trace(traceId string) []SkyWalkingSpan {
+	return r.Filter(func(span SkyWalkingSpan) bool { return span.TraceId == traceId })
+}
+
+// Roots 返回没有父span的span，即各链路的入口
+func (r *SkyWalkingMemoryReporter) Roots() []SkyWalkingSpan {
+	return r.Filter(func(span SkyWalkingSpan) bool { return span.ParentSpanId < 0 && span.RefSegmentId == "" })
+}
+
+// Children 返回直接子span，包括同一segment内及通过ref关联的其他segment
+func (r *SkyWalkingMemoryReporter) Children(parent SkyWalkingSpan) []SkyWalkingSpan {
+	return r.Filter(func(span SkyWalkingSpan) bool {
+		if span.SegmentId == parent.SegmentId {
+			return span.ParentSpanId == parent.SpanId && span.SpanId != parent.SpanId
+		}
+		return span.ParentSpanId < 0 && span.RefSegmentId == parent.SegmentId && span.RefSpanId == parent.SpanId
+	})
+}
+
+// WaitForSpans go2sky 在segment结束后异步上报，等待直到span数量不少于n或超时，返回是否满足
+func (r *SkyWalkingMemoryReporter) WaitForSpans(n int, timeout time.Duration) bool {
+	// 先确定截止时间，定时器触发时一定已到截止时间；加锁广播避免在检查与等待之间丢失唤醒
+	deadline := time.Now().Add(timeout)
+	timer := time.AfterFunc(timeout, func() {
+		r.lock.Lock()
+		r.cond.Broadcast()
+		r.lock.Unlock()
+	})
+	defer timer.Stop()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for len(r.spans) < n {
+		if r.closed || !time.Now().Before(deadline) {
+			return false
+		}
+		r.cond.Wait()
+	}
+	return true
+}
+
+// Reset 清空已保存的span
+func (r *SkyWalkingMemoryReporter) Reset() {
+	r.lock.Lock()
+	r.spans = nil
+	r.lock.Unlock()
+}
+
+// skyWalkingNoopReporter 丢弃所有span
+type skyWalkingNoopReporter struct{}
+
+func (skyWalkingNoopReporter) Boot(service string, serviceInstance string, cdsWatchers []go2sky.AgentConfigChangeWatcher) {
+}
+
+func (skyWalkingNoopReporter) Send(spans []go2sky.ReportedSpan) {}
+
+func (skyWalkingNoopReporter) Close() {}
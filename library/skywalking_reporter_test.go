@@ -0,0 +1,98 @@
+package library
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestSkyWalking(t *testing.T) (TracerInterface, *SkyWalkingMemoryReporter) {
+	t.Helper()
+	sky, err := NewSkyWalkingTracker(&SkyWalkingConfig{
+		ServiceName: "base-test",
+		Sample:      1,
+		Reporter:    SkyWalkingReporterMemory,
+	})
+	if err != nil {
+		t.Fatalf("create tracer: %v", err)
+	}
+	t.Cleanup(sky.Close)
+	reporter := sky.MemoryReporter()
+	if reporter == nil {
+		t.Fatal("memory reporter not created")
+	}
+	return sky.AsTracer(), reporter
+}
+
+// 本地span -> exit span -> 下游entry span，通过sw8请求头跨segment关联
+func TestSkyWalkingMemoryReporterSpanTree(t *testing.T) {
+	tracer, reporter := newTestSkyWalking(t)
+
+	root, ctx, err := tracer.StartLocalSpan(context.Background(), "job")
+	if err != nil {
+		t.Fatalf("start local span: %v", err)
+	}
+	carrier := make(map[string]string)
+	exit, _, err := tracer.StartExitSpan(ctx, "/api/order", "order.svc:80", SpanLayerHttp, func(key, value string) error {
+		carrier[key] = value
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("start exit span: %v", err)
+	}
+	entry, _, err := tracer.StartEntrySpan(context.Background(), "/api/order", SpanLayerHttp, func(key string) (string, error) {
+		return carrier[key], nil
+	})
+	if err != nil {
+		t.Fatalf("start entry span: %v", err)
+	}
+	entry.End()
+	exit.End()
+	root.End()
+
+	if !reporter.WaitForSpans(3, 5*time.Second) {
+		t.Fatalf("got %d spans, want 3", len(reporter.Spans()))
+	}
+
+	roots := reporter.Roots()
+	if len(roots) != 1 || roots[0].OperationName != "job" {
+		t.Fatalf("roots %+v, want job", roots)
+	}
+	children := reporter.Children(roots[0])
+	if len(children) != 1 || children[0].SpanType != "Exit" || children[0].Peer != "order.svc:80" {
+		t.Fatalf("children of job %+v, want exit span", children)
+	}
+	downstream := reporter.Children(children[0])
+	if len(downstream) != 1 || downstream[0].SpanType != "Entry" || downstream[0].SegmentId == roots[0].SegmentId {
+		t.Fatalf("children of exit %+v, want entry span in another segment", downstream)
+	}
+	if trace := reporter.Trace(roots[0].TraceId); len(trace) != 3 {
+		t.Fatalf("trace has %d spans, want 3", len(trace))
+	}
+	if spans := reporter.FindByOperation("/api/order"); len(spans) != 2 {
+		t.Fatalf("found %d /api/order spans, want 2", len(spans))
+	}
+
+	reporter.Reset()
+	if spans := reporter.Spans(); len(spans) != 0 {
+		t.Fatalf("got %d spans after reset", len(spans))
+	}
+}
+
+func TestSkyWalkingMemoryReporterWaitTimeout(t *testing.T) {
+	reporter := NewSkyWalkingMemoryReporter()
+	start := time.Now()
+	if reporter.WaitForSpans(1, 20*time.Millisecond) {
+		t.Fatal("wait succeeded without spans")
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("wait returned after %s", elapsed)
+	}
+
+	// 关闭后不再等待
+	reporter.Close()
+	start = time.Now()
+	if reporter.WaitForSpans(1, time.Second) || time.Since(start) > 500*time.Millisecond {
+		t.Fatal("wait did not return after close")
+	}
+}
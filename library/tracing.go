@@ -0,0 +1,189 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// SpanLayer span 所属的调用类型，决定 SkyWalking 的 layer 及 OpenTelemetry 的 span kind
+type SpanLayer int
+
+const (
+	SpanLayerUnknown SpanLayer = iota
+	SpanLayerHttp
+	SpanLayerDatabase
+	SpanLayerCache
+	SpanLayerMQ
+)
+
+// 通用的 span 标签，与 go2sky 的标签名一致，OpenTelemetry 实现中转换为对应的语义约定
+const (
+	TagHTTPMethod  = "http.method"
+	TagURL         = "url"
+	TagStatusCode  = "status_code"
+	TagDBType      = "db.type"
+	TagDBStatement = "db.statement"
+	TagMQBroker    = "mq.broker"
+	TagMQTopic     = "mq.topic"
+)
+
+// 链路追踪后端
+const (
+	TracingSkyWalking    = "skywalking"
+	TracingOpenTelemetry = "opentelemetry"
+	TracingBoth          = "both" // 同时上报两个系统并透传两种请求头，用于混合部署迁移期间
+)
+
+// TracerInterface 链路追踪后端，inject/extract 用于在请求头、消息头中透传链路信息
+type TracerInterface interface {
+	StartEntrySpan(ctx context.Context, operation string, layer SpanLayer, extract func(key string) (string, error)) (SpanInterface, context.Context, error)
+	StartExitSpan(ctx context.Context, operation, peer string, layer SpanLayer, inject func(key, value string) error) (SpanInterface, context.Context, error)
+	StartLocalSpan(ctx context.Context, operation string) (SpanInterface, context.Context, error)
+	Close() error
+}
+
+// SpanInterface 与后端无关的 span
+type SpanInterface interface {
+	SetOperationName(name string)
+	SetComponent(componentId int32) // SkyWalking 组件id，OpenTelemetry 中记录为属性
+	Tag(key, value string)
+	Error(err error)
+	End()
+}
+
+type tracerHolder struct {
+	tracer TracerInterface
+}
+
+var globalTracer atomic.Value
+
+// SetGlobalTracer 设置全局链路追踪，传入nil时关闭
+func SetGlobalTracer(tracer TracerInterface) {
+	globalTracer.Store(tracerHolder{tracer: tracer})
+}
+
+// GetGlobalTracer 返回全局链路追踪，未设置时兼容直接调用 go2sky.SetGlobalTracer 的情况，都没有时返回nil
+func GetGlobalTracer() TracerInterface {
+	if holder, ok := globalTracer.Load().(tracerHolder); ok && holder.tracer != nil {
+		return holder.tracer
+	}
+	return globalSkyWalkingTracer()
+}
+
+// TracingConfig 选择链路追踪后端
+type TracingConfig struct {
+	Backend       string // skywalking/opentelemetry/both，默认 skywalking
+	SkyWalking    SkyWalkingConfig
+	OpenTelemetry OpenTelemetryConfig
+}
+
+// NewTracer 按配置创建链路追踪，创建后需调用 SetGlobalTracer 生效
+func NewTracer(conf *TracingConfig) (TracerInterface, error) {
+	switch conf.Backend {
+	case "", TracingSkyWalking:
+		sky, err := NewSkyWalkingTracker(&conf.SkyWalking)
+		if err != nil {
+			return nil, err
+		}
+		return sky.AsTracer(), nil
+	case TracingOpenTelemetry:
+		return NewOpenTelemetryTracer(&conf.OpenTelemetry)
+	case TracingBoth:
+		sky, err := NewSkyWalkingTracker(&conf.SkyWalking)
+		if err != nil {
+			return nil, err
+		}
+		otel, err := NewOpenTelemetryTracer(&conf.OpenTelemetry)
+		if err != nil {
+			return nil, err
+		}
+		return &multiTracer{tracers: []TracerInterface{sky.AsTracer(), otel}}, nil
+	}
+	return nil, fmt.Errorf("unsupported tracing backend %s", conf.Backend)
+}
+
+// multiTracer 同时在多个后端创建span，inject 时写入各后端的请求头
+type multiTracer struct {
+	tracers []TracerInterface
+}
+
+func (t *multiTracer) StartEntrySpan(ctx context.Context, operation string, layer SpanLayer, extract func(key string) (string, error)) (SpanInterface, context.Context, error) {
+	return t.start(ctx, func(tracer TracerInterface, ctx context.Context) (SpanInterface, context.Context, error) {
+		return tracer.StartEntrySpan(ctx, operation, layer, extract)
+	})
+}
+
+func (t *multiTracer) StartExitSpan(ctx context.Context, operation, peer string, layer SpanLayer, inject func(key, value string) error) (SpanInterface, context.Context, error) {
+	return t.start(ctx, func(tracer TracerInterface, ctx context.Context) (SpanInterface, context.Context, error) {
+		return tracer.StartExitSpan(ctx, operation, peer, layer, inject)
+	})
+}
+
+func (t *multiTracer) StartLocalSpan(ctx context.Context, operation string) (SpanInterface, context.Context, error) {
+	return t.start(ctx, func(tracer TracerInterface, ctx context.Context) (SpanInterface, context.Context, error) {
+		return tracer.StartLocalSpan(ctx, operation)
+	})
+}
+
+// start 依次创建，后一个后端使用前一个返回的context，某个后端失败时忽略该后端
+func (t *multiTracer) start(ctx context.Context, create func(tracer TracerInterface, ctx context.Context) (SpanInterface, context.Context, error)) (SpanInterface, context.Context, error) {
+	spans := make(multiSpan, 0, len(t.tracers))
+	var firstErr error
+	for _, tracer := range t.tracers {
+		span, spanCtx, err := create(tracer, ctx)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		spans = append(spans, span)
+		ctx = spanCtx
+	}
+	if len(spans) == 0 {
+		return nil, ctx, firstErr
+	}
+	return spans, ctx, nil
+}
+
+func (t *multiTracer) Close() (err error) {
+	for _, tracer := range t.tracers {
+		if e := tracer.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+type multiSpan []SpanInterface
+
+func (s multiSpan) SetOperationName(name string) {
+	for _, span := range s {
+		span.SetOperationName(name)
+	}
+}
+
+func (s multiSpan) SetComponent(componentId int32) {
+	for _, span := range s {
+		span.SetComponent(componentId)
+	}
+}
+
+func (s multiSpan) Tag(key, value string) {
+	for _, span := range s {
+		span.Tag(key, value)
+	}
+}
+
+func (s multiSpan) Error(err error) {
+	for _, span := range s {
+		span.Error(err)
+	}
+}
+
+func (s multiSpan) End() {
+	for _, span := range s {
+		span.End()
+	}
+}
@@ -0,0 +1,168 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const otelInstrumentationName = "github.com/ctl5563096/base"
+
+// OpenTelemetryConfig 通过 OTLP gRPC 上报，透传 W3C traceparent/baggage 请求头
+type OpenTelemetryConfig struct {
+	ServiceName        string            // 当前服务名
+	Endpoint           string            // OTLP gRPC 地址，如 otel-collector:4317
+	Insecure           bool              // 不使用TLS连接 collector
+	Headers            map[string]string // 上报时附加的请求头，如鉴权token
+	Sample             float64           // 采样率 0~1，未设置(0)时全部采样，上游已采样时跟随上游
+	ResourceAttributes map[string]string // 附加的资源属性，如 deployment.environment
+}
+
+// 通用标签到 OpenTelemetry 语义约定的映射
+var otelAttributeKeys = map[string]string{
+	TagURL:        "http.url",
+	TagStatusCode: "http.status_code",
+	TagDBType:     "db.system",
+	TagMQTopic:    "messaging.destination.name",
+	TagMQBroker:   "server.address",
+}
+
+// OpenTelemetry TracerInterface 的 OpenTelemetry 实现
+type OpenTelemetry struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+func NewOpenTelemetryTracer(conf *OpenTelemetryConfig) (*OpenTelemetry, error) {
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(conf.Endpoint)}
+	if conf.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	if len(conf.Headers) > 0 {
+		opts = append(opts, otlptracegrpc.WithHeaders(conf.Headers))
+	}
+	exporter, err := otlptracegrpc.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("创建 otlp exporter 失败:%w", err)
+	}
+
+	attributes := []attribute.KeyValue{attribute.String("service.name", conf.ServiceName)}
+	for key, value := range conf.ResourceAttributes {
+		attributes = append(attributes, attribute.String(key, value))
+	}
+	// 未设置采样率时全部采样，避免零值配置丢弃所有链路
+	sample := conf.Sample
+	if sample <= 0 {
+		sample = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attributes...)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sample))),
+	)
+	return &OpenTelemetry{
+		provider:   provider,
+		tracer:     provider.Tracer(otelInstrumentationName),
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}, nil
+}
+
+// Provider 供需要直接使用 OpenTelemetry API 的组件使用
+func (o *OpenTelemetry) Provider() *sdktrace.TracerProvider {
+	return o.provider
+}
+
+func (o *OpenTelemetry) StartEntrySpan(ctx context.Context, operation string, layer SpanLayer, extract func(key string) (string, error)) (SpanInterface, context.Context, error) {
+	ctx = o.propagator.Extract(ctx, funcCarrier{get: extract})
+	kind := trace.SpanKindServer
+	if layer == SpanLayerMQ {
+		kind = trace.SpanKindConsumer
+	}
+	ctx, span := o.tracer.Start(ctx, operation, trace.WithSpanKind(kind))
+	return &otelSpan{span: span}, ctx, nil
+}
+
+func (o *OpenTelemetry) StartExitSpan(ctx context.Context, operation, peer string, layer SpanLayer, inject func(key, value string) error) (SpanInterface, context.Context, error) {
+	kind := trace.SpanKindClient
+	if layer == SpanLayerMQ {
+		kind = trace.SpanKindProducer
+	}
+	ctx, span := o.tracer.Start(ctx, operation,
+		trace.WithSpanKind(kind),
+		trace.WithAttributes(attribute.String("peer.address", peer)))
+	o.propagator.Inject(ctx, funcCarrier{set: inject})
+	return &otelSpan{span: span}, ctx, nil
+}
+
+func (o *OpenTelemetry) StartLocalSpan(ctx context.Context, operation string) (SpanInterface, context.Context, error) {
+	ctx, span := o.tracer.Start(ctx, operation, trace.WithSpanKind(trace.SpanKindInternal))
+	return &otelSpan{span: span}, ctx, nil
+}
+
+// Close 上报剩余的span
+func (o *OpenTelemetry) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return o.provider.Shutdown(ctx)
+}
+
+// funcCarrier 将 inject/extract 函数适配为 propagation.TextMapCarrier
+type funcCarrier struct {
+	get func(key string) (string, error)
+	set func(key, value string) error
+}
+
+func (c funcCarrier) Get(key string) string {
+	if c.get == nil {
+		return ""
+	}
+	value, _ := c.get(key)
+	return value
+}
+
+func (c funcCarrier) Set(key, value string) {
+	if c.set != nil {
+		_ = c.set(key, value)
+	}
+}
+
+func (c funcCarrier) Keys() []string {
+	return nil
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s *otelSpan) SetOperationName(name string) {
+	s.span.SetName(name)
+}
+
+func (s *otelSpan) SetComponent(componentId int32) {
+	s.span.SetAttributes(attribute.Int("sw8.component", int(componentId)))
+}
+
+func (s *otelSpan) Tag(key, value string) {
+	if mapped, ok := otelAttributeKeys[key]; ok {
+		key = mapped
+	}
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+func (s *otelSpan) Error(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *otelSpan) End() {
+	s.span.End()
+}
@@ -0,0 +1,101 @@
+package library
+
+import (
+	"context"
+	"time"
+
+	"github.com/SkyAPM/go2sky"
+	agentv3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+var skyWalkingLayers = map[SpanLayer]agentv3.SpanLayer{
+	SpanLayerHttp:     agentv3.SpanLayer_Http,
+	SpanLayerDatabase: agentv3.SpanLayer_Database,
+	SpanLayerCache:    agentv3.SpanLayer_Cache,
+	SpanLayerMQ:       agentv3.SpanLayer_MQ,
+}
+
+// skyWalkingTracer TracerInterface 的 SkyWalking 实现，透传 sw8 请求头
+type skyWalkingTracer struct {
+	tracer *go2sky.Tracer
+	sky    *SkyWalking
+}
+
+// AsTracer 转换为 TracerInterface，可传给 SetGlobalTracer
+func (sky *SkyWalking) AsTracer() TracerInterface {
+	return &skyWalkingTracer{tracer: sky.Tracer, sky: sky}
+}
+
+// globalSkyWalkingTracer 包装 go2sky 的全局 tracer，未设置时返回nil
+func globalSkyWalkingTracer() TracerInterface {
+	tracer := go2sky.GetGlobalTracer()
+	if tracer == nil {
+		return nil
+	}
+	return &skyWalkingTracer{tracer: tracer}
+}
+
+func (t *skyWalkingTracer) StartEntrySpan(ctx context.Context, operation string, layer SpanLayer, extract func(key string) (string, error)) (SpanInterface, context.Context, error) {
+	span, ctx, err := t.tracer.CreateEntrySpan(ctx, operation, extract)
+	if err != nil {
+		return nil, ctx, err
+	}
+	setSkyWalkingLayer(span, layer)
+	return &skyWalkingSpan{span: span}, ctx, nil
+}
+
+func (t *skyWalkingTracer) StartExitSpan(ctx context.Context, operation, peer string, layer SpanLayer, inject func(key, value string) error) (SpanInterface, context.Context, error) {
+	span, err := t.tracer.CreateExitSpan(ctx, operation, peer, inject)
+	if err != nil {
+		return nil, ctx, err
+	}
+	setSkyWalkingLayer(span, layer)
+	return &skyWalkingSpan{span: span}, ctx, nil
+}
+
+func (t *skyWalkingTracer) StartLocalSpan(ctx context.Context, operation string) (SpanInterface, context.Context, error) {
+	span, ctx, err := t.tracer.CreateLocalSpan(ctx)
+	if err != nil {
+		return nil, ctx, err
+	}
+	span.SetOperationName(operation)
+	return &skyWalkingSpan{span: span}, ctx, nil
+}
+
+// Close 关闭 reporter，包装 go2sky 全局 tracer 时不做处理
+func (t *skyWalkingTracer) Close() error {
+	if t.sky != nil {
+		t.sky.Close()
+	}
+	return nil
+}
+
+func setSkyWalkingLayer(span go2sky.Span, layer SpanLayer) {
+	if swLayer, ok := skyWalkingLayers[layer]; ok {
+		span.SetSpanLayer(swLayer)
+	}
+}
+
+type skyWalkingSpan struct {
+	span go2sky.Span
+}
+
+func (s *skyWalkingSpan) SetOperationName(name string) {
+	s.span.SetOperationName(name)
+}
+
+func (s *skyWalkingSpan) SetComponent(componentId int32) {
+	s.span.SetComponent(componentId)
+}
+
+func (s *skyWalkingSpan) Tag(key, value string) {
+	s.span.Tag(go2sky.Tag(key), value)
+}
+
+func (s *skyWalkingSpan) Error(err error) {
+	s.span.Error(time.Now(), err.Error())
+}
+
+func (s *skyWalkingSpan) End() {
+	s.span.End()
+}
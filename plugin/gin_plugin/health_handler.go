@@ -0,0 +1,32 @@
+package gin_plugin
+
+import (
+	"net/http"
+
+	"github.com/ctl5563096/base/library"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterHealthRoutes 注册 /health/live 存活检查和 /health/ready 就绪检查
+// 就绪检查中关键依赖异常时返回503，非关键依赖异常时返回200并标记为 degraded
+func RegisterHealthRoutes(router gin.IRoutes, registry *library.HealthRegistry) {
+	router.GET("/health/live", HealthLiveHandler(registry))
+	router.GET("/health/ready", HealthReadyHandler(registry))
+}
+
+func HealthLiveHandler(registry *library.HealthRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, registry.Live())
+	}
+}
+
+func HealthReadyHandler(registry *library.HealthRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := registry.Ready(c.Request.Context())
+		code := http.StatusOK
+		if report.Status == library.HealthDown {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, report)
+	}
+}
@@ -0,0 +1,27 @@
+package gin_plugin
+
+import (
+	"time"
+
+	"github.com/ctl5563096/base/library"
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsMiddleware 按路由模板及状态码记录请求数和耗时，未匹配路由的请求记为 unmatched，避免标签膨胀
+func MetricsMiddleware(metrics *library.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		begin := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveHttpServer(c.Request.Method, route, c.Writer.Status(), time.Since(begin))
+	}
+}
+
+// MetricsHandler 输出 prometheus text 格式指标，挂载到如 /metrics
+func MetricsHandler(metrics *library.Metrics) gin.HandlerFunc {
+	return gin.WrapH(metrics.Handler())
+}
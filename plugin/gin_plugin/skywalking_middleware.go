@@ -3,13 +3,11 @@ package gin_plugin
 import (
 	"fmt"
 	"strconv"
-	"time"
+	"strings"
 
-	"github.com/SkyAPM/go2sky"
 	"github.com/ctl5563096/base/contract"
 	"github.com/ctl5563096/base/library"
 	"github.com/gin-gonic/gin"
-	agentv3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
 )
 
 // skyWalking 上报数据中间件
@@ -19,23 +17,26 @@ func SkyWalkingReport(engine *gin.Engine, sky *library.SkyWalking) gin.HandlerFu
 			c.Next()
 		}
 	}
+	return TracingMiddleware()
+}
 
-	// 返回中间件处理
+// TracingMiddleware 链路追踪中间件，使用 library.SetGlobalTracer 设置的后端
+func TracingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 过滤掉健康检查
-		if c.Request.URL.Path == "/health" {
+		// 过滤掉健康检查及指标采集
+		if c.Request.URL.Path == "/health" || strings.HasPrefix(c.Request.URL.Path, "/health/") || c.Request.URL.Path == "/metrics" {
 			c.Next()
 			return
 		}
 
-		gTracer := go2sky.GetGlobalTracer()
+		gTracer := library.GetGlobalTracer()
 		if gTracer == nil {
 			c.Next()
 			return
 		}
 
 		// 创建span
-		span, ctx, err := gTracer.CreateEntrySpan(c.Request.Context(), getOperationName(c), func(key string) (string, error) {
+		span, ctx, err := gTracer.StartEntrySpan(c.Request.Context(), getOperationName(c), library.SpanLayerHttp, func(key string) (string, error) {
 			return c.Request.Header.Get(key), nil
 		})
 		if err != nil {
@@ -44,18 +45,17 @@ func SkyWalkingReport(engine *gin.Engine, sky *library.SkyWalking) gin.HandlerFu
 		}
 
 		span.SetComponent(contract.ComponentIDGINHttpServer)
-		span.Tag(go2sky.TagHTTPMethod, c.Request.Method)
-		span.Tag(go2sky.TagURL, c.Request.Host+c.Request.URL.Path)
-		span.SetSpanLayer(agentv3.SpanLayer_Http)
+		span.Tag(library.TagHTTPMethod, c.Request.Method)
+		span.Tag(library.TagURL, c.Request.Host+c.Request.URL.Path)
 
 		c.Request = c.Request.WithContext(ctx)
 
 		c.Next()
 
 		if len(c.Errors) > 0 {
-			span.Error(time.Now(), c.Errors.String())
+			span.Error(fmt.Errorf("%s", c.Errors.String()))
 		}
-		span.Tag(go2sky.TagStatusCode, strconv.Itoa(c.Writer.Status()))
+		span.Tag(library.TagStatusCode, strconv.Itoa(c.Writer.Status()))
 		span.End()
 	}
 }